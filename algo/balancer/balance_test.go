@@ -1,8 +1,16 @@
 package balancer
 
 import (
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/cocktail828/go-tools/exp/healthy"
+	"github.com/cocktail828/go-tools/xlog"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -51,3 +59,520 @@ func TestCandidate(t *testing.T) {
 		t.Logf("%-16s before: %v, after: %v, failed: %v", b, old, b.Nodes(), v)
 	}
 }
+
+func TestCandidateUpdate(t *testing.T) {
+	b := NewRoundRobin([]Node{X(3), X(2), X(1)})
+
+	// removing nodes only must be applied as well
+	b.Update([]Node{X(3), X(1)})
+	assert.ElementsMatch(t, []Node{X(3), X(1)}, b.Nodes())
+
+	b.Update([]Node{X(1), X(3)})
+	assert.ElementsMatch(t, []Node{X(3), X(1)}, b.Nodes())
+
+	b.Update([]Node{X(1), X(3), X(4)})
+	assert.ElementsMatch(t, []Node{X(1), X(3), X(4)}, b.Nodes())
+}
+
+type sick int
+
+func (x sick) Value() any    { return x }
+func (x sick) Weight() int   { return int(x) }
+func (x sick) Healthy() bool { return false }
+func (x sick) MarkFailure()  {}
+
+func TestWRRSkipUnhealthy(t *testing.T) {
+	b := NewWeightRoundRobin([]Node{sick(5), X(1)})
+	for range 10 {
+		assert.Equal(t, X(1), b.Pick().Value())
+	}
+	assert.Nil(t, NewWeightRoundRobin([]Node{sick(5)}).Pick())
+}
+
+func TestRandom(t *testing.T) {
+	assert.Equal(t, X(1), NewRandom([]Node{X(1)}).Pick().Value())
+	assert.Equal(t, X(1), NewRandom([]Node{sick(2), X(1), sick(3)}).Pick().Value())
+	assert.Nil(t, NewRandom([]Node{sick(2)}).Pick())
+}
+
+func TestCandidateConcurrentFailure(t *testing.T) {
+	// the picked nodes are removed by MarkFailure while other picks are running
+	for _, strategy := range []func([]Node) Balancer{NewRoundRobin, NewWeightRoundRobin, NewFailover, NewRandom} {
+		b := strategy(nil)
+		var wg sync.WaitGroup
+		for range 4 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range 2000 {
+					if n := b.Pick(); n != nil {
+						n.MarkFailure()
+					} else {
+						b.Update([]Node{X(1), X(2), X(3)})
+					}
+				}
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+func TestLeastRequest(t *testing.T) {
+	assert.Nil(t, NewLeastRequest(nil).Pick())
+	assert.Nil(t, NewLeastRequest([]Node{sick(1)}).Pick())
+
+	b := NewLeastRequest([]Node{X(1), X(2)})
+	// the heavier node takes two requests for one of the other
+	cnt := map[any]int{}
+	for range 6 {
+		cnt[b.Pick().Value()]++
+	}
+	assert.Equal(t, map[any]int{X(1): 2, X(2): 4}, cnt)
+
+	// finished requests free the node
+	n := b.Pick()
+	assert.Implements(t, (*Tracker)(nil), n)
+	Finish(n, time.Millisecond)
+	Finish(X(1), time.Millisecond) // no-op
+	for range 3 {
+		Finish(b.Pick(), 0)
+	}
+
+	// the load survives updates
+	b.Update([]Node{X(2), X(3)})
+	assert.Equal(t, X(3), b.Pick().Value())
+}
+
+func TestP2C(t *testing.T) {
+	assert.Nil(t, NewP2C(nil).Pick())
+	assert.Equal(t, X(1), NewP2C([]Node{sick(2), X(1)}).Pick().Value())
+
+	// busy nodes get less traffic
+	b := NewP2C([]Node{X(1), X(2), X(3)})
+	busy := b.Pick()
+	for range 10 {
+		b.(*p2cBalancer).stats[busy.Value()].inflight.Add(1)
+	}
+	for range 100 {
+		n := b.Pick()
+		assert.NotEqual(t, busy.Value(), n.Value())
+		Finish(n, 0)
+	}
+}
+
+func TestPeakEWMA(t *testing.T) {
+	assert.Nil(t, NewPeakEWMA(nil).Pick())
+
+	assert.Equal(t, X(1), NewPeakEWMA([]Node{X(1)}).Pick().Value())
+
+	// the slow node is avoided
+	b := NewPeakEWMA([]Node{X(1), X(2)})
+	fast, slow := b.(*ewmaBalancer).stats[X(1)], b.(*ewmaBalancer).stats[X(2)]
+	fast.inflight.Add(1)
+	fast.finish(time.Millisecond)
+	slow.inflight.Add(1)
+	slow.finish(time.Millisecond * 100)
+	cnt := map[any]int{}
+	for range 100 {
+		n := b.Pick()
+		cnt[n.Value()]++
+		Finish(n, 0)
+	}
+	assert.Equal(t, 100, cnt[X(1)])
+
+	// a peak is taken at once, faster responses decay it
+	slow.finish(time.Second)
+	assert.Equal(t, float64(time.Second), slow.latency())
+	slow.stamp = time.Now().Add(-DecayTime)
+	slow.finish(0)
+	assert.InDelta(t, float64(time.Second)/math.E, slow.latency(), float64(time.Millisecond))
+}
+
+// S is a node of weight 1
+type S string
+
+func (s S) Value() any    { return s }
+func (s S) Weight() int   { return 1 }
+func (s S) Healthy() bool { return true }
+func (s S) MarkFailure()  {}
+
+func keyedBalancers() map[string]func([]Node) Balancer {
+	return map[string]func([]Node) Balancer{
+		"consistenthash":  NewConsistentHash,
+		"boundedloadhash": NewBoundedLoadHash,
+		"maglev":          NewMaglev,
+	}
+}
+
+func TestPickKey(t *testing.T) {
+	nodes := func(n int) []Node {
+		res := []Node{}
+		for i := range n {
+			res = append(res, S("node-"+strconv.Itoa(i+1)))
+		}
+		return res
+	}
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = "user-" + strconv.Itoa(i)
+	}
+
+	for name, builder := range keyedBalancers() {
+		assert.Nil(t, builder(nil).Pick(), name)
+		assert.Nil(t, PickKey(builder([]Node{sick(1)}), "a"), name)
+
+		b := builder(nodes(4))
+		before := map[string]any{}
+		for _, key := range keys {
+			n := PickKey(b, key)
+			Finish(n, 0)
+			before[key] = n.Value()
+			n = PickKey(b, key)
+			Finish(n, 0)
+			assert.Equal(t, before[key], n.Value(), name)
+		}
+
+		// adding a node only remaps a minimal share of the keys
+		b.Update(nodes(5))
+		moved, others := 0, 0
+		for _, key := range keys {
+			n := PickKey(b, key)
+			if n.Value() == S("node-5") {
+				moved++
+			} else if n.Value() != before[key] {
+				others++
+			}
+			Finish(n, 0)
+		}
+		t.Logf("%s: moved to the new node: %d, between old nodes: %d", name, moved, others)
+		assert.InDelta(t, len(keys)/5, moved, float64(len(keys))/10, name)
+		if name == "maglev" {
+			// maglev trades a little disruption for a perfectly even table
+			assert.Less(t, others, len(keys)/20, name)
+		} else {
+			assert.Zero(t, others, name)
+		}
+
+		// the keys of a failed node go to the others
+		n := PickKey(b, keys[0])
+		failed := n.Value()
+		n.MarkFailure()
+		assert.NotEqual(t, failed, PickKey(b, keys[0]).Value(), name)
+	}
+
+	// balancers without keys pick as usual
+	assert.Equal(t, X(1), PickKey(NewRoundRobin([]Node{X(1)}), "a").Value())
+}
+
+func TestBoundedLoadHash(t *testing.T) {
+	b := NewBoundedLoadHash([]Node{X(1), X(2), X(3)})
+
+	// a hot key spills over once its node is loaded
+	var picked []Node
+	cnt := map[any]int{}
+	for range 60 {
+		n := PickKey(b, "hot")
+		picked = append(picked, n)
+		cnt[n.Value()]++
+	}
+	assert.Greater(t, len(cnt), 1)
+	for v, c := range cnt {
+		assert.LessOrEqual(t, c, int(math.Ceil(BoundedLoadFactor*60*float64(v.(X))/6)), v)
+	}
+
+	// the hot key comes back once the load is gone
+	first := picked[0].Value()
+	for _, n := range picked {
+		Finish(n, 0)
+	}
+	assert.Equal(t, first, PickKey(b, "hot").Value())
+}
+
+func TestMaglevWeight(t *testing.T) {
+	b := NewMaglev([]Node{X(1), X(3)}).(*maglevBalancer)
+	cnt := map[any]int{}
+	for _, n := range b.table {
+		cnt[n.Value()]++
+	}
+	assert.InDelta(t, 3, float64(cnt[X(3)])/float64(cnt[X(1)]), 0.01)
+}
+
+// fail picks the node and marks it failed
+func fail(b Balancer, val any) {
+	for range 100 {
+		if n := b.Pick(); n.Value() == val {
+			n.MarkFailure()
+			return
+		}
+	}
+}
+
+func TestOutlierConsecutive(t *testing.T) {
+	b := WithOutlier(NewRoundRobin, Outlier{Consecutive: 3, BaseEjection: 100 * time.Millisecond})(
+		[]Node{S("a"), S("b"), S("c"), S("d")})
+
+	fail(b, S("a"))
+	fail(b, S("a"))
+	MarkSuccess(b.Pick())
+	assert.Len(t, b.Nodes(), 4, "success resets the consecutive failures")
+
+	for range 3 {
+		fail(b, S("a"))
+	}
+	assert.Len(t, b.Nodes(), 3)
+	for range 10 {
+		assert.NotEqual(t, S("a"), b.Pick().Value())
+	}
+	assert.Eventually(t, func() bool { return len(b.Nodes()) == 4 }, time.Second, 10*time.Millisecond)
+
+	// the second ejection in a row takes twice as long
+	for range 3 {
+		fail(b, S("a"))
+	}
+	start := time.Now()
+	assert.Eventually(t, func() bool { return len(b.Nodes()) == 4 }, time.Second, 10*time.Millisecond)
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+}
+
+func TestOutlierFailureRate(t *testing.T) {
+	b := WithOutlier(NewRoundRobin, Outlier{FailureRate: 0.5, MinRequests: 10, BaseEjection: time.Minute})(
+		[]Node{S("a"), S("b")})
+
+	for range 4 {
+		for range 100 {
+			if n := b.Pick(); n.Value() == S("a") {
+				MarkSuccess(n)
+				break
+			}
+		}
+		fail(b, S("a"))
+	}
+	assert.Len(t, b.Nodes(), 2, "too few requests")
+
+	fail(b, S("a"))
+	fail(b, S("a"))
+	assert.Len(t, b.Nodes(), 1)
+	assert.Equal(t, S("b"), b.Pick().Value())
+}
+
+func TestOutlierMaxEjection(t *testing.T) {
+	b := WithOutlier(NewRoundRobin, Outlier{Consecutive: 1, MaxEjectionPercent: 50, BaseEjection: time.Minute})(
+		[]Node{S("a"), S("b"), S("c"), S("d")})
+
+	for _, s := range []S{"a", "b", "c"} {
+		fail(b, s)
+	}
+	assert.Len(t, b.Nodes(), 2)
+
+	// the last node is never ejected
+	b = WithOutlier(NewRoundRobin, Outlier{Consecutive: 1, MaxEjectionPercent: 100, BaseEjection: time.Minute})(
+		[]Node{S("a"), S("b")})
+	fail(b, S("a"))
+	fail(b, S("b"))
+	assert.Len(t, b.Nodes(), 1)
+	assert.NotNil(t, b.Pick())
+}
+
+type switchEvaluater struct{ alive atomic.Bool }
+
+func (e *switchEvaluater) Check(error) {}
+func (e *switchEvaluater) Alive() bool { return e.alive.Load() }
+
+func TestOutlierKeepalive(t *testing.T) {
+	el := &switchEvaluater{}
+	el.alive.Store(true)
+	ka := healthy.NewKeepalive(el, healthy.ProbeFunc(func() error { return nil }), xlog.NopPrinter{})
+	b := WithOutlier(NewRoundRobin, Outlier{
+		BaseEjection: 50 * time.Millisecond,
+		Keepalive: func(n Node) healthy.Keepalive {
+			if n.Value() == S("a") {
+				return ka
+			}
+			return nil
+		},
+	})([]Node{S("a"), S("b")})
+
+	fail(b, S("a"))
+	assert.Len(t, b.Nodes(), 2)
+
+	el.alive.Store(false)
+	time.Sleep(150 * time.Millisecond) // the keepalive caches its state for a while
+	fail(b, S("a"))
+	assert.Len(t, b.Nodes(), 1)
+
+	time.Sleep(200 * time.Millisecond)
+	assert.Len(t, b.Nodes(), 1, "not alive yet")
+
+	el.alive.Store(true)
+	assert.Eventually(t, func() bool { return len(b.Nodes()) == 2 }, time.Second, 10*time.Millisecond)
+}
+
+func TestOutlierProbe(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+
+	// the ejected node gets no request, only the probes bring its keepalive back
+	var probes atomic.Int64
+	probe := healthy.SocketProbe{Addr: ln.Addr().String(), Network: "tcp", Timeout: time.Second}
+	ka := healthy.NewKeepalive(healthy.NewCounterEvaluater(2, 3),
+		healthy.ProbeFunc(func() error { probes.Add(1); return probe.Probe() }), xlog.NopPrinter{})
+	b := WithOutlier(NewRoundRobin, Outlier{
+		BaseEjection:  50 * time.Millisecond,
+		ProbeInterval: 20 * time.Millisecond,
+		Keepalive: func(n Node) healthy.Keepalive {
+			if n.Value() == S("a") {
+				return ka
+			}
+			return nil
+		},
+	})([]Node{S("a"), S("b")})
+
+	for range 3 {
+		fail(b, S("a"))
+	}
+	time.Sleep(150 * time.Millisecond) // the keepalive caches its state for a while
+	fail(b, S("a"))
+	assert.Len(t, b.Nodes(), 1)
+	assert.Eventually(t, func() bool { return probes.Load() > 3 }, time.Second, 10*time.Millisecond)
+
+	// the failures expire and the probes succeed
+	assert.Eventually(t, func() bool { return len(b.Nodes()) == 2 }, 6*time.Second, 20*time.Millisecond)
+
+	// the probing stops once re-admitted
+	time.Sleep(50 * time.Millisecond)
+	n := probes.Load()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, n, probes.Load())
+}
+
+type zoned struct {
+	S
+	region, zone string
+	sick         bool
+}
+
+func (z *zoned) Healthy() bool              { return !z.sick }
+func (z *zoned) Locality() (string, string) { return z.region, z.zone }
+
+func TestLocality(t *testing.T) {
+	local := []*zoned{{S: "a1", region: "r", zone: "a"}, {S: "a2", region: "r", zone: "a"}}
+	nodes := []Node{local[0], local[1],
+		&zoned{S: "b1", region: "r", zone: "b"},
+		&zoned{S: "x1", region: "x", zone: "x"},
+		S("unknown"),
+	}
+	b := WithLocality(NewRoundRobin, Locality{Region: "r", Zone: "a", Spillover: 0.8})(nodes)
+	assert.Len(t, b.Nodes(), 5)
+
+	count := func() map[any]int {
+		m := map[any]int{}
+		for range 10000 {
+			m[b.Pick().Value()]++
+		}
+		return m
+	}
+	m := count()
+	assert.Equal(t, 10000, m[S("a1")]+m[S("a2")], "all goes to the local zone")
+
+	// half of the local zone is down: the local zone takes 0.5/0.8 of the traffic, the region takes the rest
+	local[1].sick = true
+	m = count()
+	assert.Zero(t, m[S("a2")])
+	assert.InDelta(t, 6250, m[S("a1")], 500)
+	assert.InDelta(t, 3750, m[S("b1")], 500)
+	assert.Zero(t, m[S("x1")]+m[S("unknown")])
+
+	// the local region is gone, the remote nodes take over
+	local[0].sick = true
+	b.Update(nodes[:2])
+	assert.Nil(t, b.Pick())
+	b.Update(nodes)
+	nodes[2].(*zoned).sick = true
+	m = count()
+	assert.Equal(t, 10000, m[S("x1")]+m[S("unknown")])
+	assert.InDelta(t, 5000, m[S("x1")], 200, "remote nodes are balanced by the strategy")
+
+	// the key stays on the same node with a keyed strategy
+	local[0].sick, local[1].sick = false, false
+	b = WithLocality(NewConsistentHash, Locality{Region: "r", Zone: "a"})(nodes)
+	n := PickKey(b, "k")
+	for range 10 {
+		assert.Equal(t, n.Value(), PickKey(b, "k").Value())
+	}
+}
+
+func TestLocalityPriority(t *testing.T) {
+	nodes := []Node{
+		&zoned{S: "p0", region: "x", zone: "x"},
+		&zoned{S: "p1", region: "r", zone: "a"},
+	}
+	b := WithLocality(NewRoundRobin, Locality{Region: "r", Zone: "a", Priority: func(n Node) int {
+		return int(n.Value().(S)[1] - '0')
+	}})(nodes)
+	for range 100 {
+		assert.Equal(t, S("p0"), b.Pick().Value(), "lower tier goes first whatever the locality")
+	}
+
+	nodes[0].(*zoned).sick = true
+	assert.Equal(t, S("p1"), b.Pick().Value())
+}
+
+func TestSlowStart(t *testing.T) {
+	ss := SlowStart{Window: 300 * time.Millisecond}
+	for name, strategy := range map[string]func([]Node) Balancer{
+		"wrr":          NewWeightRoundRobin,
+		"leastrequest": NewLeastRequest,
+	} {
+		b := WithSlowStart(strategy, ss)([]Node{S("a"), S("b")})
+		count := func() int {
+			// keep the requests in flight, so the load per weight decides
+			picked := make([]Node, 0, 2100)
+			var c int
+			for range 2100 {
+				n := b.Pick()
+				if n.Value() == S("c") {
+					c++
+				}
+				picked = append(picked, n)
+			}
+			for _, n := range picked {
+				Finish(n, 0)
+			}
+			return c
+		}
+		assert.Equal(t, 0, count(), name)
+
+		b.Update([]Node{S("a"), S("b"), S("c")})
+		assert.Less(t, count(), 300, name+": the new node starts at a fraction of its weight")
+
+		time.Sleep(ss.Window)
+		assert.InDelta(t, 700, count(), 50, name+": the new node is warm")
+	}
+
+	// without slow start the new node takes its full weight at once
+	b := NewWeightRoundRobin([]Node{S("a"), S("b")})
+	b.Update([]Node{S("a"), S("b"), S("c")})
+	m := map[any]int{}
+	for range 300 {
+		m[b.Pick().Value()]++
+	}
+	assert.Equal(t, 100, m[S("c")])
+
+	// the initial nodes are warm
+	b = WithSlowStart(NewWeightRoundRobin, ss)([]Node{S("a"), S("b")})
+	m = map[any]int{}
+	for range 100 {
+		m[b.Pick().Value()]++
+	}
+	assert.Equal(t, 50, m[S("a")])
+}
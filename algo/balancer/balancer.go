@@ -51,13 +51,17 @@ func (c *Candidate) Update(nodes []Node) {
 	}
 
 	c.mu.RLock()
+	changed := len(tmp) != len(c.nodes)
 	for _, n := range c.nodes {
-		delete(tmp, n.Value())
+		if _, ok := tmp[n.Value()]; !ok {
+			changed = true
+			break
+		}
 	}
 	c.mu.RUnlock()
 
 	// nodes not changed
-	if len(tmp) == 0 {
+	if !changed {
 		return
 	}
 
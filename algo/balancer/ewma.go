@@ -0,0 +1,34 @@
+package balancer
+
+import "time"
+
+type ewmaBalancer struct {
+	loadBalancer
+}
+
+// NewPeakEWMA picks two random nodes and takes the one with lower peak EWMA latency times outstanding requests
+// A slower response raises the latency of a node at once, while faster ones decay it within DecayTime.
+// The picked node implements Tracker, the caller must report the finish of the request.
+func NewPeakEWMA(nodes []Node) Balancer {
+	b := &ewmaBalancer{}
+	b.init(nodes)
+	return b
+}
+
+func (b *ewmaBalancer) String() string {
+	return "peakewma"
+}
+
+func (b *ewmaBalancer) Pick() Node {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.p2c(func(n Node) float64 {
+		st := b.stats[n.Value()]
+		inflight := float64(st.inflight.Load() + 1)
+		if lat := st.latency(); lat > 0 {
+			return lat * inflight / b.effective(n)
+		}
+		// nodes without samples are tried soon, but not flooded
+		return float64(time.Millisecond) * inflight / b.effective(n)
+	})
+}
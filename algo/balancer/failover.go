@@ -14,13 +14,12 @@ func (b *failoverBalancer) String() string {
 }
 
 func (b *failoverBalancer) Pick() Node {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
 	if len(b.nodes) == 0 {
 		return nil
 	}
 
-	b.mu.RLock()
-	defer b.mu.RUnlock()
-
 	for i := range uint32(len(b.nodes)) {
 		idx := (i + b.pos) % uint32(len(b.nodes))
 		if n := b.nodes[idx]; n.Healthy() {
@@ -0,0 +1,156 @@
+package balancer
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"github.com/cocktail828/go-tools/algo/hashring"
+)
+
+// KeyedBalancer picks nodes by key, the same key goes to the same node as long as the node is available
+type KeyedBalancer interface {
+	Balancer
+	// PickKey picks a node for the key
+	// It returns nil if no node is available
+	PickKey(key string) Node
+}
+
+// PickKey picks a node for the key if the balancer is a KeyedBalancer, otherwise it falls back to Pick
+func PickKey(b Balancer, key string) Node {
+	if kb, ok := b.(KeyedBalancer); ok {
+		return kb.PickKey(key)
+	}
+	return b.Pick()
+}
+
+// BoundedLoadFactor is how much a node may exceed the average load in the bounded load consistent hash
+var BoundedLoadFactor = 1.25
+
+// nodeKey returns the name of the node on the hash ring and in the maglev table
+func nodeKey(n Node) string { return fmt.Sprint(n.Value()) }
+
+func randomKey() string { return strconv.FormatUint(rand.Uint64(), 36) }
+
+// keyedNode rebuilds the lookup structure of the balancer once the node is removed
+type keyedNode struct {
+	Node
+	rebuild func()
+}
+
+func (n keyedNode) MarkFailure() {
+	n.Node.MarkFailure()
+	n.rebuild()
+}
+
+func (n keyedNode) Finish(latency time.Duration) { Finish(n.Node, latency) }
+
+type ringBalancer struct {
+	loadBalancer
+	bounded bool
+	ring    *hashring.HashRing
+	byKey   map[string]Node
+}
+
+// NewConsistentHash places the nodes on a hash ring by weight, a key goes to the first healthy node clockwise
+// Adding or removing a node only remaps the keys of its own arcs, as long as the weights are equal,
+// otherwise the hashring rescales the arcs of all nodes.
+// The balancer implements KeyedBalancer, Pick uses a random key.
+func NewConsistentHash(nodes []Node) Balancer {
+	b := &ringBalancer{}
+	b.init(nodes)
+	return b
+}
+
+// NewBoundedLoadHash is consistent hashing with bounded loads, a node takes at most BoundedLoadFactor
+// times its weighted share of the outstanding requests, the overflow goes on clockwise.
+// The picked node implements Tracker, the caller must report the finish of the request.
+// view: https://arxiv.org/abs/1608.01350
+func NewBoundedLoadHash(nodes []Node) Balancer {
+	b := &ringBalancer{bounded: true}
+	b.init(nodes)
+	return b
+}
+
+func (b *ringBalancer) String() string {
+	if b.bounded {
+		return "boundedloadhash"
+	}
+	return "consistenthash"
+}
+
+func (b *ringBalancer) init(nodes []Node) {
+	b.loadBalancer.init(nodes)
+	b.rebuildLocked()
+}
+
+func (b *ringBalancer) rebuildLocked() {
+	weights := make(map[string]int, len(b.nodes))
+	b.byKey = make(map[string]Node, len(b.nodes))
+	for _, n := range b.nodes {
+		key := nodeKey(n)
+		weights[key] = int(weight(n))
+		b.byKey[key] = n
+	}
+	b.ring = hashring.New()
+	b.ring.AddMany(weights)
+}
+
+func (b *ringBalancer) rebuild() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rebuildLocked()
+}
+
+func (b *ringBalancer) Update(nodes []Node) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.updateLocked(nodes)
+	b.rebuildLocked()
+}
+
+func (b *ringBalancer) Pick() Node {
+	return b.PickKey(randomKey())
+}
+
+func (b *ringBalancer) PickKey(key string) Node {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	// capacity of a node per weight
+	var capacity float64
+	if b.bounded {
+		var total, weights float64
+		for _, n := range b.nodes {
+			if n.Healthy() {
+				total += float64(b.stats[n.Value()].inflight.Load())
+				weights += weight(n)
+			}
+		}
+		capacity = BoundedLoadFactor * (total + 1) / weights
+	}
+
+	var picked Node
+	b.ring.Walk(key, func(k string) bool {
+		n := b.byKey[k]
+		if !n.Healthy() {
+			return true
+		}
+		if b.bounded && float64(b.stats[n.Value()].inflight.Load()) >= math.Ceil(capacity*weight(n)) {
+			return true
+		}
+		picked = n
+		return false
+	})
+
+	switch {
+	case picked == nil:
+		return nil
+	case b.bounded:
+		return keyedNode{b.pick(picked), b.rebuild}
+	default:
+		return keyedNode{fallibleNode{picked, &b.Candidate}, b.rebuild}
+	}
+}
@@ -0,0 +1,49 @@
+package balancer
+
+import (
+	"math/rand/v2"
+)
+
+type leastRequestBalancer struct {
+	loadBalancer
+}
+
+// NewLeastRequest picks the node with the least outstanding requests per weight
+// The picked node implements Tracker, the caller must report the finish of the request.
+func NewLeastRequest(nodes []Node) Balancer {
+	b := &leastRequestBalancer{}
+	b.init(nodes)
+	return b
+}
+
+func (b *leastRequestBalancer) String() string {
+	return "leastrequest"
+}
+
+func (b *leastRequestBalancer) Pick() Node {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if len(b.nodes) == 0 {
+		return nil
+	}
+
+	// start at a random position, so ties are spread
+	var best Node
+	var bestLoad float64
+	start := rand.IntN(len(b.nodes))
+	for i := range len(b.nodes) {
+		n := b.nodes[(start+i)%len(b.nodes)]
+		if !n.Healthy() {
+			continue
+		}
+		load := float64(b.stats[n.Value()].inflight.Load()) / b.effective(n)
+		if best == nil || load < bestLoad {
+			best, bestLoad = n, load
+		}
+	}
+
+	if best == nil {
+		return nil
+	}
+	return b.pick(best)
+}
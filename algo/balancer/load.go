@@ -0,0 +1,153 @@
+package balancer
+
+import (
+	"math"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Tracker is implemented by the nodes picked from the load aware balancers.
+// Picking a node starts a request on it, the caller must report the finish of the request once.
+type Tracker interface {
+	Node
+	// Finish marks the request as finished, latency is the duration of the request
+	Finish(latency time.Duration)
+}
+
+// Finish reports the request on the picked node is finished
+// It is a no-op if the node is not picked from a load aware balancer.
+func Finish(n Node, latency time.Duration) {
+	if t, ok := n.(Tracker); ok {
+		t.Finish(latency)
+	}
+}
+
+// DecayTime is the time window of the peak EWMA latency, older samples weigh less than 1/e
+var DecayTime = 10 * time.Second
+
+// loadStat is the load of a node
+type loadStat struct {
+	inflight atomic.Int64
+
+	mu    sync.Mutex
+	ewma  float64 // latency in nanoseconds
+	stamp time.Time
+}
+
+func (s *loadStat) finish(latency time.Duration) {
+	s.inflight.Add(-1)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	rtt := float64(latency)
+	if s.stamp.IsZero() || rtt > s.ewma {
+		// peak sensitive: a slower response is taken at once
+		s.ewma = rtt
+	} else {
+		w := math.Exp(-float64(now.Sub(s.stamp)) / float64(DecayTime))
+		s.ewma = s.ewma*w + rtt*(1-w)
+	}
+	s.stamp = now
+}
+
+func (s *loadStat) latency() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ewma
+}
+
+type trackedNode struct {
+	fallibleNode
+	stat *loadStat
+}
+
+func (n trackedNode) Finish(latency time.Duration) { n.stat.finish(latency) }
+
+// loadBalancer keeps the load of the nodes, the load of a node survives updates
+type loadBalancer struct {
+	Candidate
+	slowStart
+	stats map[any]*loadStat
+}
+
+func (b *loadBalancer) init(nodes []Node) {
+	b.stats = map[any]*loadStat{}
+	b.Candidate.updateLocked(nodes) // the initial nodes are warm
+	b.updateLocked(nodes)
+}
+
+func (b *loadBalancer) updateLocked(nodes []Node) {
+	b.slowStart.updateLocked(b.nodes, nodes)
+	b.Candidate.updateLocked(nodes)
+	stats := make(map[any]*loadStat, len(nodes))
+	for _, n := range nodes {
+		if st, ok := b.stats[n.Value()]; ok {
+			stats[n.Value()] = st
+		} else {
+			stats[n.Value()] = &loadStat{}
+		}
+	}
+	b.stats = stats
+}
+
+func (b *loadBalancer) Update(nodes []Node) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.updateLocked(nodes)
+}
+
+// healthy returns the healthy nodes, the caller must hold the lock
+func (b *loadBalancer) healthy() []Node {
+	res := make([]Node, 0, len(b.nodes))
+	for _, n := range b.nodes {
+		if n.Healthy() {
+			res = append(res, n)
+		}
+	}
+	return res
+}
+
+// pick starts a request on the node, the caller must hold the lock
+func (b *loadBalancer) pick(n Node) Node {
+	st := b.stats[n.Value()]
+	st.inflight.Add(1)
+	return trackedNode{fallibleNode{n, &b.Candidate}, st}
+}
+
+// p2c picks two random healthy nodes and takes the one with lower cost, the caller must hold the lock
+func (b *loadBalancer) p2c(cost func(Node) float64) Node {
+	nodes := b.healthy()
+	switch len(nodes) {
+	case 0:
+		return nil
+	case 1:
+		return b.pick(nodes[0])
+	}
+
+	i := rand.IntN(len(nodes))
+	j := rand.IntN(len(nodes) - 1)
+	if j >= i {
+		j++
+	}
+	a, c := nodes[i], nodes[j]
+	if cost(c) < cost(a) {
+		a = c
+	}
+	return b.pick(a)
+}
+
+// effective returns the weight of the node during slow start, the caller must hold the lock
+func (b *loadBalancer) effective(n Node) float64 {
+	return weight(n) * b.factor(n)
+}
+
+// weight returns the weight of the node, nodes without weight count as 1
+func weight(n Node) float64 {
+	if w := n.Weight(); w > 0 {
+		return float64(w)
+	}
+	return 1
+}
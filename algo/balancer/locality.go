@@ -0,0 +1,175 @@
+package balancer
+
+import (
+	"cmp"
+	"math/rand/v2"
+	"slices"
+	"sync"
+
+	"github.com/cocktail828/go-tools/algo/hash/murmur3"
+)
+
+// Located is implemented by the nodes knowing where they are
+type Located interface {
+	Node
+	// Locality returns the region and the zone of the node
+	Locality() (region, zone string)
+}
+
+// Locality configures the locality aware routing
+type Locality struct {
+	Region string // region of the caller
+	Zone   string // zone of the caller
+	// Spillover is the healthy ratio of a level under which part of the traffic spills to the next levels, default 0.7.
+	// A level takes min(1, healthy/Spillover) of the traffic left over by the previous levels.
+	Spillover float64
+	// Priority returns the priority tier of the node, a lower tier is preferred to any locality of higher tiers.
+	// All nodes are in tier 0 by default.
+	Priority func(Node) int
+}
+
+// proximity of the node to the caller: same zone, same region, elsewhere
+func (l *Locality) proximity(n Node) int {
+	ln, ok := n.(Located)
+	if !ok {
+		return 2
+	}
+	region, zone := ln.Locality()
+	switch {
+	case region == l.Region && zone == l.Zone:
+		return 0
+	case region == l.Region:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// level is the nodes of the same tier and proximity
+type level struct {
+	tier      int
+	proximity int
+	total     int
+	balancer  Balancer
+}
+
+// share returns the share of the traffic the level takes
+func (lv *level) share(spillover float64) float64 {
+	var healthy int
+	for _, n := range lv.balancer.Nodes() {
+		if n.Healthy() {
+			healthy++
+		}
+	}
+	return min(1, float64(healthy)/float64(lv.total)/spillover)
+}
+
+type localityBalancer struct {
+	Locality
+	strategy func([]Node) Balancer
+
+	mu     sync.RWMutex
+	levels []*level
+}
+
+// WithLocality wraps the strategy with locality aware routing, the result is a strategy as well.
+// The nodes are grouped by priority tier and by proximity to the caller, every group is balanced by the strategy.
+// The traffic goes to the local zone first, then to the local region and the other regions,
+// as long as the healthy nodes of the preferred groups fall below Spillover.
+// The nodes not implementing Located are regarded as remote.
+func WithLocality(strategy func([]Node) Balancer, l Locality) func([]Node) Balancer {
+	if l.Spillover <= 0 || l.Spillover > 1 {
+		l.Spillover = 0.7
+	}
+	return func(nodes []Node) Balancer {
+		b := &localityBalancer{Locality: l, strategy: strategy}
+		b.Update(nodes)
+		return b
+	}
+}
+
+func (b *localityBalancer) String() string {
+	return "locality"
+}
+
+func (b *localityBalancer) Nodes() []Node {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	var nodes []Node
+	for _, lv := range b.levels {
+		nodes = append(nodes, lv.balancer.Nodes()...)
+	}
+	return nodes
+}
+
+// Update regroups the nodes, the balancers of the groups still present are updated in place
+func (b *localityBalancer) Update(nodes []Node) {
+	type key struct{ tier, proximity int }
+	groups := map[key][]Node{}
+	for _, n := range nodes {
+		k := key{proximity: b.proximity(n)}
+		if b.Priority != nil {
+			k.tier = b.Priority(n)
+		}
+		groups[k] = append(groups[k], n)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	old := map[key]*level{}
+	for _, lv := range b.levels {
+		old[key{lv.tier, lv.proximity}] = lv
+	}
+
+	levels := make([]*level, 0, len(groups))
+	for k, ns := range groups {
+		lv, ok := old[k]
+		if ok {
+			lv.balancer.Update(ns)
+		} else {
+			lv = &level{tier: k.tier, proximity: k.proximity, balancer: b.strategy(ns)}
+		}
+		lv.total = len(ns)
+		levels = append(levels, lv)
+	}
+	slices.SortFunc(levels, func(x, y *level) int {
+		return cmp.Or(cmp.Compare(x.tier, y.tier), cmp.Compare(x.proximity, y.proximity))
+	})
+	b.levels = levels
+}
+
+// pick walks the levels, r in [0, 1) chooses the level by the shares
+func (b *localityBalancer) pick(r float64, pick func(Balancer) Node) Node {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	left := 1.0
+	for _, lv := range b.levels {
+		share := left * lv.share(b.Spillover)
+		if r < share {
+			if n := pick(lv.balancer); n != nil {
+				return n
+			}
+		}
+		r -= share
+		left -= share
+	}
+
+	// every level spills over, take the first one available
+	for _, lv := range b.levels {
+		if n := pick(lv.balancer); n != nil {
+			return n
+		}
+	}
+	return nil
+}
+
+func (b *localityBalancer) Pick() Node {
+	return b.pick(rand.Float64(), Balancer.Pick)
+}
+
+// PickKey chooses the level by the key as well, so the same key stays in the same level
+func (b *localityBalancer) PickKey(key string) Node {
+	r := float64(murmur3.Sum64([]byte(key))>>11) / (1 << 53)
+	return b.pick(r, func(lb Balancer) Node { return PickKey(lb, key) })
+}
@@ -0,0 +1,111 @@
+package balancer
+
+import (
+	"github.com/cocktail828/go-tools/algo/hash/murmur3"
+)
+
+// MaglevTableSize is the size of the maglev lookup table, it must be a prime much larger than the number of nodes
+var MaglevTableSize = 65537
+
+type maglevBalancer struct {
+	Candidate
+	table []Node
+}
+
+// NewMaglev builds a maglev lookup table filled by the nodes in proportion to their weights.
+// A key is hashed to an entry of the table, unhealthy nodes are skipped by probing the following entries.
+// Adding or removing a node only remaps a minimal share of the entries.
+// The balancer implements KeyedBalancer, Pick uses a random key.
+// view: https://research.google/pubs/maglev-a-fast-and-reliable-software-network-load-balancer/
+func NewMaglev(nodes []Node) Balancer {
+	b := &maglevBalancer{}
+	b.updateLocked(nodes)
+	return b
+}
+
+func (b *maglevBalancer) String() string {
+	return "maglev"
+}
+
+func (b *maglevBalancer) updateLocked(nodes []Node) {
+	b.Candidate.updateLocked(nodes)
+	b.table = populate(b.nodes, MaglevTableSize)
+}
+
+func (b *maglevBalancer) rebuild() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.table = populate(b.nodes, MaglevTableSize)
+}
+
+func (b *maglevBalancer) Update(nodes []Node) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.updateLocked(nodes)
+}
+
+// populate fills the table by the permutations of the nodes, heavier nodes take more turns
+func populate(nodes []Node, size int) []Node {
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	m := uint64(size)
+	offset := make([]uint64, len(nodes))
+	skip := make([]uint64, len(nodes))
+	next := make([]uint64, len(nodes))
+	credit := make([]float64, len(nodes))
+	var maxWeight float64
+	for i, n := range nodes {
+		h1, h2 := murmur3.Sum128([]byte(nodeKey(n)))
+		offset[i] = h1 % m
+		skip[i] = h2%(m-1) + 1
+		maxWeight = max(maxWeight, weight(n))
+	}
+
+	table := make([]Node, size)
+
+	for filled := 0; filled < size; {
+		for i, n := range nodes {
+			credit[i] += weight(n) / maxWeight
+			if credit[i] < 1 {
+				continue
+			}
+			credit[i]--
+
+			for {
+				c := (offset[i] + next[i]*skip[i]) % m
+				next[i]++
+				if table[c] == nil {
+					table[c] = n
+					filled++
+					break
+				}
+			}
+			if filled == size {
+				break
+			}
+		}
+	}
+	return table
+}
+
+func (b *maglevBalancer) Pick() Node {
+	return b.PickKey(randomKey())
+}
+
+func (b *maglevBalancer) PickKey(key string) Node {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if len(b.table) == 0 {
+		return nil
+	}
+
+	entry := murmur3.Sum64([]byte(key)) % uint64(len(b.table))
+	for i := range uint64(len(b.table)) {
+		if n := b.table[(entry+i)%uint64(len(b.table))]; n.Healthy() {
+			return keyedNode{fallibleNode{n, &b.Candidate}, b.rebuild}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,294 @@
+package balancer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cocktail828/go-tools/exp/healthy"
+	"github.com/pkg/errors"
+)
+
+// Reporter is implemented by the nodes picked from the outlier detecting balancer.
+// Besides MarkFailure, the caller reports the successful requests, so the failure rate can be told.
+type Reporter interface {
+	Node
+	// MarkSuccess marks the request on the node as succeeded
+	MarkSuccess()
+}
+
+// MarkSuccess reports the request on the picked node is succeeded
+// It is a no-op if the node is not picked from an outlier detecting balancer.
+func MarkSuccess(n Node) {
+	if r, ok := n.(Reporter); ok {
+		r.MarkSuccess()
+	}
+}
+
+var errFailure = errors.New("request failed")
+
+// Outlier configures the outlier detection, a zero threshold disables the matching rule
+type Outlier struct {
+	Consecutive        int           // eject a node after so many consecutive failures
+	FailureRate        float64       // eject a node whose failure rate in Interval reaches it, in (0, 1]
+	MinRequests        int           // the failure rate is not considered before so many requests in Interval
+	Interval           time.Duration // window of the failure rate, default 10s
+	BaseEjection       time.Duration // ejection time of the first ejection, it doubles on every ejection in a row, default 30s
+	MaxEjection        time.Duration // max ejection time, default 5m
+	MaxEjectionPercent int           // max percentage of the nodes ejected at the same time, default 50
+	// Keepalive returns the keepalive of the node, optional.
+	// The outcomes of the requests are fed to it, a node is ejected once it is not alive,
+	// and an ejected node is not re-admitted until it is alive again.
+	// An ejected node gets no request, so its keepalive probes in background every ProbeInterval until re-admitted.
+	Keepalive     func(Node) healthy.Keepalive
+	ProbeInterval time.Duration // default 1s
+}
+
+func (o *Outlier) normalize() {
+	if o.Interval <= 0 {
+		o.Interval = 10 * time.Second
+	}
+	if o.BaseEjection <= 0 {
+		o.BaseEjection = 30 * time.Second
+	}
+	if o.MaxEjection <= 0 {
+		o.MaxEjection = 5 * time.Minute
+	}
+	if o.MaxEjectionPercent <= 0 {
+		o.MaxEjectionPercent = 50
+	}
+	if o.ProbeInterval <= 0 {
+		o.ProbeInterval = time.Second
+	}
+}
+
+// ejection returns the ejection time after so many ejections in a row
+func (o *Outlier) ejection(times int) time.Duration {
+	d := o.BaseEjection
+	for i := 1; i < times && d < o.MaxEjection; i++ {
+		d *= 2
+	}
+	return min(d, o.MaxEjection)
+}
+
+// outlierStat is the outcomes of a node, it is guarded by the lock of the balancer
+type outlierStat struct {
+	node        Node
+	ka          healthy.Keepalive
+	consecutive int
+	since       time.Time // start of the failure rate window
+	success     int
+	failure     int
+	ejections   int // ejections in a row
+	ejected     bool
+	admitted    time.Time // last re-admission
+	timer       *time.Timer
+	stopProbe   context.CancelFunc // stops the background probing of the keepalive while ejected
+}
+
+func (st *outlierStat) reset(now time.Time) {
+	st.consecutive, st.success, st.failure = 0, 0, 0
+	st.since = now
+}
+
+// stop cancels the pending re-admission and the background probing
+func (st *outlierStat) stop() {
+	if st.timer != nil {
+		st.timer.Stop()
+		st.timer = nil
+	}
+	if st.stopProbe != nil {
+		st.stopProbe()
+		st.stopProbe = nil
+	}
+}
+
+type outlierBalancer struct {
+	Outlier
+	inner Balancer
+
+	mu    sync.Mutex
+	nodes []Node
+	stats map[any]*outlierStat
+}
+
+// WithOutlier wraps the strategy with outlier detection, the result is a strategy as well.
+// A failing node is ejected from the strategy for an exponentially growing time instead of being removed,
+// and it is re-admitted once the time is up. A re-admitted node ramps up again if the strategy has WithSlowStart.
+// The picked node implements Reporter, MarkFailure only counts a failure and does not reach the node.
+func WithOutlier(strategy func([]Node) Balancer, o Outlier) func([]Node) Balancer {
+	o.normalize()
+	return func(nodes []Node) Balancer {
+		b := &outlierBalancer{Outlier: o, inner: strategy(nil)}
+		b.Update(nodes)
+		return b
+	}
+}
+
+func (b *outlierBalancer) String() string {
+	if s, ok := b.inner.(interface{ String() string }); ok {
+		return "outlier(" + s.String() + ")"
+	}
+	return "outlier"
+}
+
+// Nodes returns the nodes not ejected
+func (b *outlierBalancer) Nodes() []Node {
+	return b.inner.Nodes()
+}
+
+func (b *outlierBalancer) Update(nodes []Node) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	stats := make(map[any]*outlierStat, len(nodes))
+	for _, n := range nodes {
+		if st, ok := b.stats[n.Value()]; ok {
+			st.node = n
+			stats[n.Value()] = st
+			continue
+		}
+		st := &outlierStat{node: n, admitted: now}
+		if b.Keepalive != nil {
+			st.ka = b.Keepalive(n)
+		}
+		st.reset(now)
+		stats[n.Value()] = st
+	}
+	for val, st := range b.stats {
+		if _, ok := stats[val]; !ok {
+			st.stop()
+		}
+	}
+
+	b.nodes = nodes
+	b.stats = stats
+	b.updateLocked()
+}
+
+// updateLocked hands the nodes not ejected to the strategy
+func (b *outlierBalancer) updateLocked() {
+	nodes := make([]Node, 0, len(b.nodes))
+	for _, n := range b.nodes {
+		if !b.stats[n.Value()].ejected {
+			nodes = append(nodes, n)
+		}
+	}
+	b.inner.Update(nodes)
+}
+
+func (b *outlierBalancer) wrap(n Node) Node {
+	if n == nil {
+		return nil
+	}
+	b.mu.Lock()
+	st := b.stats[n.Value()]
+	b.mu.Unlock()
+	if st == nil {
+		return n
+	}
+	return outlierNode{n, st, b}
+}
+
+func (b *outlierBalancer) Pick() Node {
+	return b.wrap(b.inner.Pick())
+}
+
+func (b *outlierBalancer) PickKey(key string) Node {
+	return b.wrap(PickKey(b.inner, key))
+}
+
+func (b *outlierBalancer) report(st *outlierStat, err error) {
+	if st.ka != nil {
+		st.ka.Check(err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// the node is ejected or removed already
+	if st.ejected || b.stats[st.node.Value()] != st {
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(st.since) > b.Interval {
+		st.success, st.failure = 0, 0
+		st.since = now
+	}
+	if err == nil {
+		st.consecutive = 0
+		st.success++
+		return
+	}
+	st.consecutive++
+	st.failure++
+
+	total := st.success + st.failure
+	switch {
+	case b.Consecutive > 0 && st.consecutive >= b.Consecutive:
+	case b.FailureRate > 0 && total >= b.MinRequests && float64(st.failure)/float64(total) >= b.FailureRate:
+	case st.ka != nil && !st.ka.Alive():
+	default:
+		return
+	}
+	b.ejectLocked(st, now)
+}
+
+// ejectLocked ejects the node unless too many nodes are ejected already
+func (b *outlierBalancer) ejectLocked(st *outlierStat, now time.Time) {
+	var ejected int
+	for _, s := range b.stats {
+		if s.ejected {
+			ejected++
+		}
+	}
+	limit := max(len(b.stats)*b.MaxEjectionPercent/100, 1)
+	if ejected >= limit || ejected+1 >= len(b.stats) {
+		return
+	}
+
+	// a node staying admitted for long starts over
+	if now.Sub(st.admitted) > b.MaxEjection {
+		st.ejections = 0
+	}
+	st.ejections++
+	st.ejected = true
+	st.timer = time.AfterFunc(b.ejection(st.ejections), func() { b.readmit(st) })
+	if st.ka != nil {
+		st.stopProbe = st.ka.Background(b.ProbeInterval)
+	}
+	b.updateLocked()
+}
+
+func (b *outlierBalancer) readmit(st *outlierStat) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !st.ejected || b.stats[st.node.Value()] != st {
+		return
+	}
+
+	// wait until the keepalive tells the node is alive
+	if st.ka != nil && !st.ka.Alive() {
+		st.timer = time.AfterFunc(b.BaseEjection, func() { b.readmit(st) })
+		return
+	}
+
+	now := time.Now()
+	st.ejected = false
+	st.admitted = now
+	st.stop()
+	st.reset(now)
+	b.updateLocked()
+}
+
+// outlierNode reports the outcomes of the request to the balancer
+type outlierNode struct {
+	Node
+	stat *outlierStat
+	b    *outlierBalancer
+}
+
+func (n outlierNode) MarkFailure()                 { n.b.report(n.stat, errFailure) }
+func (n outlierNode) MarkSuccess()                 { n.b.report(n.stat, nil) }
+func (n outlierNode) Finish(latency time.Duration) { Finish(n.Node, latency) }
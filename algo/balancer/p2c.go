@@ -0,0 +1,25 @@
+package balancer
+
+type p2cBalancer struct {
+	loadBalancer
+}
+
+// NewP2C picks two random nodes and takes the one with less outstanding requests per weight
+// The picked node implements Tracker, the caller must report the finish of the request.
+func NewP2C(nodes []Node) Balancer {
+	b := &p2cBalancer{}
+	b.init(nodes)
+	return b
+}
+
+func (b *p2cBalancer) String() string {
+	return "p2c"
+}
+
+func (b *p2cBalancer) Pick() Node {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.p2c(func(n Node) float64 {
+		return float64(b.stats[n.Value()].inflight.Load()+1) / b.effective(n)
+	})
+}
@@ -1,12 +1,7 @@
 package balancer
 
 import (
-	"math/rand"
-	"time"
-)
-
-var (
-	randGen = rand.New(rand.NewSource(time.Now().UnixNano()))
+	"math/rand/v2"
 )
 
 type randomBalancer struct {
@@ -22,15 +17,16 @@ func (b *randomBalancer) String() string {
 }
 
 func (b *randomBalancer) Pick() Node {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
 	if len(b.nodes) == 0 {
 		return nil
 	}
 
-	b.mu.RLock()
-	defer b.mu.RUnlock()
-
-	for i := 0; i < len(b.nodes)/2; i++ {
-		n := b.nodes[randGen.Intn(len(b.nodes))]
+	// start at a random position and take the first healthy node
+	start := rand.IntN(len(b.nodes))
+	for i := range len(b.nodes) {
+		n := b.nodes[(start+i)%len(b.nodes)]
 		if n.Healthy() {
 			return fallibleNode{n, &b.Candidate}
 		}
@@ -17,13 +17,12 @@ func (b *rrBalancer) String() string {
 }
 
 func (b *rrBalancer) Pick() Node {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	if len(b.nodes) == 0 {
 		return nil
 	}
 
-	b.mu.Lock()
-	defer b.mu.Unlock()
-
 	for i := range uint32(len(b.nodes)) {
 		idx := (i + b.pos) % uint32(len(b.nodes))
 		if n := b.nodes[idx]; n.Healthy() {
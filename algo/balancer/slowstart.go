@@ -0,0 +1,84 @@
+package balancer
+
+import (
+	"time"
+)
+
+// SlowStart configures how a node ramps up to its full weight in the weighted strategies after it joins,
+// a node removed on failure and added back by Update ramps up again.
+// The nodes given to the constructors are regarded as warm.
+type SlowStart struct {
+	Window    time.Duration // how long a new node ramps up, 0 disables slow start
+	MinWeight float64       // the fraction of the weight a node starts with, in (0, 1], default 0.1
+}
+
+// slowStarter is implemented by the strategies supporting slow start
+type slowStarter interface {
+	setSlowStart(SlowStart)
+}
+
+// WithSlowStart enables slow start on the strategy, the result is a strategy as well.
+// It applies to NewWeightRoundRobin, NewLeastRequest, NewP2C and NewPeakEWMA, the other strategies are left as is.
+// It wraps the weighted strategy directly, e.g. WithOutlier(WithSlowStart(NewWeightRoundRobin, s), o).
+func WithSlowStart(strategy func([]Node) Balancer, s SlowStart) func([]Node) Balancer {
+	if s.MinWeight <= 0 || s.MinWeight > 1 {
+		s.MinWeight = 0.1
+	}
+	return func(nodes []Node) Balancer {
+		b := strategy(nodes)
+		if ss, ok := b.(slowStarter); ok {
+			ss.setSlowStart(s)
+		}
+		return b
+	}
+}
+
+// slowStart keeps when the nodes joined, it is guarded by the lock of the balancer
+type slowStart struct {
+	SlowStart
+	since map[any]time.Time
+}
+
+// setSlowStart is called once the balancer is built, before it is shared
+func (s *slowStart) setSlowStart(cfg SlowStart) {
+	s.SlowStart = cfg
+}
+
+// updateLocked records the nodes new to prev, the nodes warmed up are forgotten
+func (s *slowStart) updateLocked(prev, nodes []Node) {
+	if s.Window <= 0 {
+		s.since = nil
+		return
+	}
+
+	old := make(map[any]struct{}, len(prev))
+	for _, n := range prev {
+		old[n.Value()] = struct{}{}
+	}
+
+	now := time.Now()
+	since := map[any]time.Time{}
+	for _, n := range nodes {
+		if t, ok := s.since[n.Value()]; ok {
+			if now.Sub(t) < s.Window {
+				since[n.Value()] = t
+			}
+		} else if _, ok := old[n.Value()]; !ok {
+			since[n.Value()] = now
+		}
+	}
+	s.since = since
+}
+
+// factor returns the fraction of the weight the node takes for now
+func (s *slowStart) factor(n Node) float64 {
+	t, ok := s.since[n.Value()]
+	if !ok || s.Window <= 0 {
+		return 1
+	}
+	elapsed := time.Since(t)
+	if elapsed >= s.Window {
+		return 1
+	}
+	return s.MinWeight + (1-s.MinWeight)*float64(elapsed)/float64(s.Window)
+}
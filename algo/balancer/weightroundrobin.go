@@ -2,13 +2,14 @@ package balancer
 
 type wrrBalancer struct {
 	Candidate
-	busyArray []int
+	slowStart
+	busyArray []float64
 }
 
 func NewWeightRoundRobin(nodes []Node) Balancer {
 	return &wrrBalancer{
 		Candidate: Candidate{nodes: nodes},
-		busyArray: make([]int, len(nodes)),
+		busyArray: make([]float64, len(nodes)),
 	}
 }
 
@@ -19,26 +20,30 @@ func (b *wrrBalancer) String() string {
 func (b *wrrBalancer) Update(nodes []Node) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	b.updateLocked(nodes)
-	b.busyArray = make([]int, len(nodes))
+	b.slowStart.updateLocked(b.nodes, nodes)
+	b.Candidate.updateLocked(nodes)
+	b.busyArray = make([]float64, len(nodes))
 }
 
 // nginx weighted round-robin balancing
 // view: https://github.com/phusion/nginx/commit/27e94984486058d73157038f7950a0a36ecc6e35
 func (b *wrrBalancer) Pick() Node {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	if len(b.nodes) == 0 {
 		return nil
 	}
 
-	b.mu.Lock()
-	defer b.mu.Unlock()
-
-	allWeight := 0
+	allWeight := 0.0
 	pos := -1
 	for i := 0; i < len(b.nodes); i++ {
 		c := b.nodes[i]
-		allWeight += c.Weight()                             // 计算总权重
-		b.busyArray[i] += c.Weight()                        // 当前权重加上权重
+		if !c.Healthy() {
+			continue
+		}
+		w := float64(c.Weight()) * b.factor(c)              // 慢启动期间权重逐步爬升
+		allWeight += w                                      // 计算总权重
+		b.busyArray[i] += w                                 // 当前权重加上权重
 		if pos == -1 || b.busyArray[i] > b.busyArray[pos] { // 如果最优节点不存在或者当前节点由于最优节点，则赋值或者替换
 			pos = i
 		}
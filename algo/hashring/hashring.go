@@ -134,3 +134,27 @@ func (h *HashRing) Get(s string) string {
 	}
 	return h.nodes[i].key
 }
+
+// Walk visits the distinct nodes clockwise from the spot of s, the first one is the node returned by Get
+// It stops once f returns false or all nodes are visited.
+func (h *HashRing) Walk(s string, f func(key string) bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if len(h.nodes) == 0 {
+		return
+	}
+
+	v := h.hashFunc(s)
+	start := sort.Search(len(h.nodes), func(i int) bool { return h.nodes[i].spotValue >= v })
+	seen := make(map[string]struct{}, len(h.weights))
+	for i := range len(h.nodes) {
+		key := h.nodes[(start+i)%len(h.nodes)].key
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		if !f(key) || len(seen) == len(h.weights) {
+			return
+		}
+	}
+}
@@ -140,6 +140,35 @@ func TestRemove(t *testing.T) {
 	}
 }
 
+// TestWalk tests visiting the nodes clockwise
+func TestWalk(t *testing.T) {
+	hr := New()
+	hr.Walk("test-key", func(string) bool {
+		t.Fatal("Expected no node for empty hash ring")
+		return true
+	})
+
+	hr.AddMany(map[string]int{node1: 1, node2: 1, node3: 1})
+	var keys []string
+	hr.Walk("test-key", func(key string) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if len(keys) != 3 || keys[0] != hr.Get("test-key") {
+		t.Fatalf("Expected 3 distinct nodes starting with %s, got %v", hr.Get("test-key"), keys)
+	}
+
+	// the walk stops once f returns false
+	keys = keys[:0]
+	hr.Walk("test-key", func(key string) bool {
+		keys = append(keys, key)
+		return false
+	})
+	if len(keys) != 1 {
+		t.Fatalf("Expected 1 node, got %v", keys)
+	}
+}
+
 // TestUpdate tests updating a node's weight
 func TestUpdate(t *testing.T) {
 	hr := New()
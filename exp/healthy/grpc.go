@@ -0,0 +1,250 @@
+package healthy
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCProbe checks the server by the standard grpc.health.v1 Check RPC
+type GRPCProbe struct {
+	Addr    string
+	Service string // the service to check, empty for the overall health of the server
+	Timeout time.Duration
+	// Conn is used if set, otherwise a connection to Addr is made on every probe.
+	Conn grpc.ClientConnInterface
+	// DialOptions are used to connect Addr, insecure by default
+	DialOptions []grpc.DialOption
+}
+
+func (p GRPCProbe) Probe() error {
+	ctx := context.Background()
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	conn := p.Conn
+	if conn == nil {
+		opts := p.DialOptions
+		if len(opts) == 0 {
+			opts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+		}
+		cc, err := grpc.NewClient(p.Addr, opts...)
+		if err != nil {
+			return err
+		}
+		defer cc.Close()
+		conn = cc
+	}
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: p.Service})
+	if err != nil {
+		return err
+	}
+	if st := resp.GetStatus(); st != healthpb.HealthCheckResponse_SERVING {
+		return errors.Errorf("expect 'SERVING' but got '%s'", st)
+	}
+	return nil
+}
+
+// HealthServer implements the grpc.health.v1 Health service.
+// The status of a service is set by hand or fed by a source, like the aggregation of a Registry or a Keepalive.
+// The sources are evaluated on Check and periodically by Background, the watchers are told of every change.
+type HealthServer struct {
+	healthpb.UnimplementedHealthServer
+
+	mu       sync.RWMutex
+	shutdown bool
+	sources  map[string]func(context.Context) bool
+	statuses map[string]healthpb.HealthCheckResponse_ServingStatus
+	watchers map[string]map[chan healthpb.HealthCheckResponse_ServingStatus]struct{}
+}
+
+// NewHealthServer creates the health service, the overall health of the server is SERVING
+func NewHealthServer() *HealthServer {
+	return &HealthServer{
+		sources:  map[string]func(context.Context) bool{},
+		statuses: map[string]healthpb.HealthCheckResponse_ServingStatus{"": healthpb.HealthCheckResponse_SERVING},
+		watchers: map[string]map[chan healthpb.HealthCheckResponse_ServingStatus]struct{}{},
+	}
+}
+
+// Register registers the health service to the grpc server
+func (s *HealthServer) Register(srv grpc.ServiceRegistrar) {
+	healthpb.RegisterHealthServer(srv, s)
+}
+
+func toStatus(serving bool) healthpb.HealthCheckResponse_ServingStatus {
+	if serving {
+		return healthpb.HealthCheckResponse_SERVING
+	}
+	return healthpb.HealthCheckResponse_NOT_SERVING
+}
+
+// SetServingStatus sets the status of the service by hand, the source of the service is dropped
+func (s *HealthServer) SetServingStatus(service string, serving bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sources, service)
+	s.setLocked(service, toStatus(serving))
+}
+
+// SetSource feeds the status of the service by the source, it is evaluated right now
+func (s *HealthServer) SetSource(service string, source func(context.Context) bool) {
+	s.mu.Lock()
+	s.sources[service] = source
+	s.mu.Unlock()
+	s.refresh(context.Background(), service)
+}
+
+// SetRegistry feeds the status of the service by the readiness of the registry
+func (s *HealthServer) SetRegistry(service string, r *Registry) {
+	s.SetSource(service, func(ctx context.Context) bool { return r.Ready(ctx).Healthy })
+}
+
+// SetKeepalive feeds the status of the service by the keepalive
+func (s *HealthServer) SetKeepalive(service string, ka Keepalive) {
+	s.SetSource(service, func(context.Context) bool { return ka.Alive() })
+}
+
+// Shutdown sets all the services NOT_SERVING, the later updates are ignored.
+// It is supposed to be called before the grpc server stops gracefully.
+func (s *HealthServer) Shutdown() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for service := range s.statuses {
+		s.setLocked(service, healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+	s.shutdown = true
+}
+
+func (s *HealthServer) setLocked(service string, st healthpb.HealthCheckResponse_ServingStatus) {
+	if s.shutdown {
+		return
+	}
+	if old, ok := s.statuses[service]; ok && old == st {
+		return
+	}
+	s.statuses[service] = st
+	for ch := range s.watchers[service] {
+		// keep the latest status only, a slow watcher skips the stale ones
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- st
+	}
+}
+
+// refresh evaluates the source of the service, if any
+func (s *HealthServer) refresh(ctx context.Context, service string) {
+	s.mu.RLock()
+	source, ok := s.sources[service]
+	s.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	st := toStatus(source(ctx))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// the source may be replaced while evaluating
+	if _, ok := s.sources[service]; ok {
+		s.setLocked(service, st)
+	}
+}
+
+// Background evaluates all the sources periodically, so the watchers are told of the changes.
+// A non-positive interval disables the evaluation.
+func (s *HealthServer) Background(itvl time.Duration) context.CancelFunc {
+	ctx, cancel := context.WithCancel(context.Background())
+	if itvl <= 0 {
+		return cancel
+	}
+
+	go func() {
+		ticker := time.NewTicker(itvl)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.mu.RLock()
+				services := make([]string, 0, len(s.sources))
+				for service := range s.sources {
+					services = append(services, service)
+				}
+				s.mu.RUnlock()
+				for _, service := range services {
+					s.refresh(ctx, service)
+				}
+			}
+		}
+	}()
+	return cancel
+}
+
+func (s *HealthServer) Check(ctx context.Context, in *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	s.refresh(ctx, in.GetService())
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	st, ok := s.statuses[in.GetService()]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "unknown service")
+	}
+	return &healthpb.HealthCheckResponse{Status: st}, nil
+}
+
+// Watch streams the status of the service on every change, SERVICE_UNKNOWN is sent for an unknown service.
+func (s *HealthServer) Watch(in *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	service := in.GetService()
+	ch := make(chan healthpb.HealthCheckResponse_ServingStatus, 1)
+
+	s.mu.Lock()
+	st, ok := s.statuses[service]
+	if !ok {
+		st = healthpb.HealthCheckResponse_SERVICE_UNKNOWN
+	}
+	ch <- st
+	if s.watchers[service] == nil {
+		s.watchers[service] = map[chan healthpb.HealthCheckResponse_ServingStatus]struct{}{}
+	}
+	s.watchers[service][ch] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.watchers[service], ch)
+		if len(s.watchers[service]) == 0 {
+			delete(s.watchers, service)
+		}
+	}()
+
+	last := healthpb.HealthCheckResponse_ServingStatus(-1)
+	for {
+		select {
+		case st := <-ch:
+			if st == last {
+				continue
+			}
+			if err := stream.Send(&healthpb.HealthCheckResponse{Status: st}); err != nil {
+				return status.Errorf(codes.Canceled, "stream has ended: %v", err)
+			}
+			last = st
+		case <-stream.Context().Done():
+			return status.Error(codes.Canceled, "stream has ended")
+		}
+	}
+}
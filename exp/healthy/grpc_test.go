@@ -0,0 +1,100 @@
+package healthy
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cocktail828/go-tools/z"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func startHealthServer(t *testing.T, hs *HealthServer) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	z.Must(err)
+
+	srv := grpc.NewServer()
+	hs.Register(srv)
+	go srv.Serve(ln)
+	t.Cleanup(srv.Stop)
+	return ln.Addr().String()
+}
+
+func TestGRPCProbe(t *testing.T) {
+	hs := NewHealthServer()
+	hs.SetServingStatus("echo", false)
+	addr := startHealthServer(t, hs)
+
+	assert.NoError(t, GRPCProbe{Addr: addr, Timeout: time.Second}.Probe())
+	assert.ErrorContains(t, GRPCProbe{Addr: addr, Service: "echo", Timeout: time.Second}.Probe(), "NOT_SERVING")
+	assert.Error(t, GRPCProbe{Addr: addr, Service: "unknown", Timeout: time.Second}.Probe())
+
+	hs.SetServingStatus("echo", true)
+	assert.NoError(t, GRPCProbe{Addr: addr, Service: "echo", Timeout: time.Second}.Probe())
+
+	// the probe on a shared connection
+	cc, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	z.Must(err)
+	defer cc.Close()
+	assert.NoError(t, GRPCProbe{Conn: cc, Service: "echo", Timeout: time.Second}.Probe())
+
+	hs.Shutdown()
+	assert.Error(t, GRPCProbe{Conn: cc, Timeout: time.Second}.Probe())
+	hs.SetServingStatus("", true)
+	assert.Error(t, GRPCProbe{Conn: cc, Timeout: time.Second}.Probe(), "updates are ignored after shutdown")
+
+	// an unreachable server
+	assert.Error(t, GRPCProbe{Addr: "127.0.0.1:1", Timeout: 200 * time.Millisecond}.Probe())
+}
+
+func TestHealthServerWatch(t *testing.T) {
+	var down atomic.Bool
+	r := NewRegistry()
+	assert.NoError(t, r.Register(Check{Name: "db", Critical: true, Probe: ProbeFunc(func() error {
+		if down.Load() {
+			return errNoop
+		}
+		return nil
+	})}))
+
+	hs := NewHealthServer()
+	hs.SetRegistry("echo", r)
+	// a non-positive interval disables the periodical evaluation
+	hs.Background(0)()
+	hs.Background(-time.Second)()
+	cancel := hs.Background(10 * time.Millisecond)
+	defer cancel()
+	addr := startHealthServer(t, hs)
+
+	cc, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	z.Must(err)
+	defer cc.Close()
+
+	ctx, stop := context.WithTimeout(context.Background(), 5*time.Second)
+	defer stop()
+	stream, err := healthpb.NewHealthClient(cc).Watch(ctx, &healthpb.HealthCheckRequest{Service: "echo"})
+	z.Must(err)
+
+	recv := func() healthpb.HealthCheckResponse_ServingStatus {
+		resp, err := stream.Recv()
+		z.Must(err)
+		return resp.GetStatus()
+	}
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, recv())
+	down.Store(true)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, recv())
+	down.Store(false)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, recv())
+
+	// an unknown service is watched until it is known
+	stream, err = healthpb.NewHealthClient(cc).Watch(ctx, &healthpb.HealthCheckRequest{Service: "other"})
+	z.Must(err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVICE_UNKNOWN, recv())
+	hs.SetKeepalive("other", NewKeepalive(&fakeEvaluater{}, &fakeLiveness{}, nil))
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, recv())
+}
@@ -1,10 +1,14 @@
 package healthy
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 )
 
+// HealthChecker serves a hand-filled readiness.
+//
+// Deprecated: register the checks to a Registry and serve its LivezHandler and ReadyzHandler instead.
 type HealthChecker struct {
 	Ready   bool   `json:"ready,omitempty"`
 	Message string `json:"message,omitempty"`
@@ -21,3 +25,23 @@ func (hc HealthChecker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	json.NewEncoder(w).Encode(hc)
 }
+
+func serveReport(aggregate func(context.Context) Report) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := aggregate(r.Context())
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if report.Healthy {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	})
+}
+
+// LivezHandler serves the liveness report as JSON, 503 if any critical liveness check fails
+func (r *Registry) LivezHandler() http.Handler { return serveReport(r.Live) }
+
+// ReadyzHandler serves the readiness report as JSON, 503 if any critical check fails
+func (r *Registry) ReadyzHandler() http.Handler { return serveReport(r.Ready) }
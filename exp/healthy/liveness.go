@@ -1,8 +1,20 @@
 package healthy
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"net/netip"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -12,10 +24,21 @@ type Liveness interface {
 	Probe() error
 }
 
+// maxProbeRead bounds the bytes read by the probes
+const maxProbeRead = 1 << 20
+
+// defaultProbeTimeout bounds the conversation of a SocketProbe without Timeout, so a silent peer does not block it forever
+const defaultProbeTimeout = 3 * time.Second
+
 type SocketProbe struct {
 	Addr    string
-	Network string // tcp, udp
-	Timeout time.Duration
+	Network string        // tcp, udp
+	Timeout time.Duration // the conversation after the dial is bounded by 3s if it is 0
+	Send    []byte        // sent once connected, optional
+	// Expect is the bytes the reply must contain, and ExpectRegexp is the pattern the reply must match, both optional.
+	// The reply is read until it is satisfied, the peer closes or the timeout.
+	Expect       []byte
+	ExpectRegexp *regexp.Regexp
 }
 
 func (p SocketProbe) Probe() error {
@@ -23,26 +46,264 @@ func (p SocketProbe) Probe() error {
 	if err != nil {
 		return err
 	}
+	defer c.Close()
 
-	c.Close()
-	return nil
+	if len(p.Send) == 0 && len(p.Expect) == 0 && p.ExpectRegexp == nil {
+		return nil
+	}
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = defaultProbeTimeout
+	}
+	c.SetDeadline(time.Now().Add(timeout))
+	if len(p.Send) > 0 {
+		if _, err := c.Write(p.Send); err != nil {
+			return err
+		}
+	}
+	if len(p.Expect) == 0 && p.ExpectRegexp == nil {
+		return nil
+	}
+
+	matched := func(b []byte) bool {
+		return bytes.Contains(b, p.Expect) && (p.ExpectRegexp == nil || p.ExpectRegexp.Match(b))
+	}
+	var reply []byte
+	buf := make([]byte, 4096)
+	for len(reply) < maxProbeRead {
+		n, err := c.Read(buf)
+		reply = append(reply, buf[:n]...)
+		if matched(reply) {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "reply %q does not match", reply)
+		}
+	}
+	return errors.Errorf("reply %q does not match", reply)
+}
+
+// StatusRange is a range of the http status codes, both ends included
+type StatusRange struct {
+	Min, Max int
 }
 
 type HTTPProbe struct {
 	URL     string
 	Timeout time.Duration
+	Method  string      // GET by default
+	Header  http.Header // optional
+	Body    string      // optional
+	// Status is the accepted status codes, 200 only by default
+	Status []StatusRange
+	// BodyRegexp is the pattern the response body must match, optional
+	BodyRegexp *regexp.Regexp
+	// JSON asserts the response body by the dot separated paths, like "data.items.0.state".
+	// The value at the path is formatted by fmt and compared to the expected one, an empty one only requires the path exists.
+	JSON map[string]string
+	// TLSConfig is used for https, optional.
+	// InsecureSkipVerify and ServerName tweak the config without building one.
+	TLSConfig          *tls.Config
+	InsecureSkipVerify bool
+	ServerName         string
+}
+
+func (p HTTPProbe) client() *http.Client {
+	client := &http.Client{Timeout: p.Timeout}
+	if p.TLSConfig == nil && !p.InsecureSkipVerify && p.ServerName == "" {
+		return client
+	}
+
+	cfg := &tls.Config{}
+	if p.TLSConfig != nil {
+		cfg = p.TLSConfig.Clone()
+	}
+	if p.InsecureSkipVerify {
+		cfg.InsecureSkipVerify = true
+	}
+	if p.ServerName != "" {
+		cfg.ServerName = p.ServerName
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = cfg
+	transport.DisableKeepAlives = true
+	client.Transport = transport
+	return client
 }
 
 func (p HTTPProbe) Probe() error {
-	client := http.Client{Timeout: p.Timeout}
-	resp, err := client.Get(p.URL)
+	method := p.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	var body io.Reader
+	if p.Body != "" {
+		body = strings.NewReader(p.Body)
+	}
+	req, err := http.NewRequest(method, p.URL, body)
+	if err != nil {
+		return err
+	}
+	for k, vs := range p.Header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	if host := p.Header.Get("Host"); host != "" {
+		req.Host = host
+	}
+
+	resp, err := p.client().Do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
-	if code := resp.StatusCode; code != http.StatusOK {
+	code := resp.StatusCode
+	if len(p.Status) == 0 && code != http.StatusOK {
 		return errors.Errorf("expect 'http.StatusOK' but got '%d'", code)
 	}
+	if len(p.Status) > 0 && !slices.ContainsFunc(p.Status, func(r StatusRange) bool { return r.Min <= code && code <= r.Max }) {
+		return errors.Errorf("expect status in %v but got '%d'", p.Status, code)
+	}
+
+	if p.BodyRegexp == nil && len(p.JSON) == 0 {
+		return nil
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeRead))
+	if err != nil {
+		return err
+	}
+	if p.BodyRegexp != nil && !p.BodyRegexp.Match(data) {
+		return errors.Errorf("body does not match '%s'", p.BodyRegexp)
+	}
+	if len(p.JSON) > 0 {
+		// the numbers are kept as they are, so a large one is not formatted like 1e+06
+		var doc any
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&doc); err != nil {
+			return errors.Wrap(err, "body is not json")
+		}
+		for path, expect := range p.JSON {
+			val, ok := jsonPath(doc, path)
+			if !ok {
+				return errors.Errorf("json path '%s' not found", path)
+			}
+			if got := fmt.Sprint(val); expect != "" && got != expect {
+				return errors.Errorf("expect '%s' at json path '%s' but got '%s'", expect, path, got)
+			}
+		}
+	}
+	return nil
+}
+
+// jsonPath walks the decoded json by the dot separated keys and array indexes
+func jsonPath(doc any, path string) (any, bool) {
+	if path == "" {
+		return doc, true
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch v := doc.(type) {
+		case map[string]any:
+			val, ok := v[key]
+			if !ok {
+				return nil, false
+			}
+			doc = val
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			doc = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// ExecProbe runs the command, the probe succeeds if the command exits with 0
+type ExecProbe struct {
+	Command string
+	Args    []string
+	Dir     string
+	Env     []string // appended to the environment of the process, optional
+	Timeout time.Duration
+	// ExpectOutput is the pattern the combined output must match, optional
+	ExpectOutput *regexp.Regexp
+}
+
+func (p ExecProbe) Probe() error {
+	ctx := context.Background()
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, p.Command, p.Args...)
+	cmd.Dir = p.Dir
+	if len(p.Env) > 0 {
+		cmd.Env = append(cmd.Environ(), p.Env...)
+	}
+	out, err := cmd.CombinedOutput()
+	if len(out) > maxProbeRead {
+		out = out[:maxProbeRead]
+	}
+	if err != nil {
+		return errors.Wrapf(err, "command output %q", bytes.TrimSpace(out))
+	}
+	if p.ExpectOutput != nil && !p.ExpectOutput.Match(out) {
+		return errors.Errorf("command output does not match '%s'", p.ExpectOutput)
+	}
+	return nil
+}
+
+// DNSProbe resolves the host, the probe succeeds if any address is resolved
+type DNSProbe struct {
+	Host    string
+	Network string // ip, ip4 or ip6, ip by default
+	Server  string // address of the dns server, like "8.8.8.8:53", the system resolver by default
+	Timeout time.Duration
+	Expect  []string // addresses that must be resolved, optional
+}
+
+func (p DNSProbe) Probe() error {
+	ctx := context.Background()
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	resolver := net.DefaultResolver
+	if p.Server != "" {
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, p.Server)
+			},
+		}
+	}
+	network := p.Network
+	if network == "" {
+		network = "ip"
+	}
+
+	addrs, err := resolver.LookupNetIP(ctx, network, p.Host)
+	if err != nil {
+		return err
+	}
+	if len(addrs) == 0 {
+		return errors.Errorf("no address of '%s'", p.Host)
+	}
+	for _, expect := range p.Expect {
+		if !slices.ContainsFunc(addrs, func(a netip.Addr) bool { return a.Unmap().String() == expect }) {
+			return errors.Errorf("expect '%s' in the addresses %v of '%s'", expect, addrs, p.Host)
+		}
+	}
 	return nil
 }
@@ -1,13 +1,16 @@
 package healthy
 
 import (
+	"bufio"
 	"encoding/json"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
 	"testing"
 	"time"
 
+	"github.com/cocktail828/go-tools/xlog"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -70,3 +73,110 @@ func TestHealthChecker(t *testing.T) {
 	HealthChecker{Ready: false}.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
 	assert.Equal(t, http.StatusForbidden, rec.Code)
 }
+
+func TestSocketProbeExpect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	// a line based server answering PONG to PING
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				line, _ := bufio.NewReader(c).ReadString('\n')
+				if line == "PING\r\n" {
+					c.Write([]byte("+PONG\r\n"))
+				} else {
+					c.Write([]byte("-ERR\r\n"))
+				}
+			}()
+		}
+	}()
+
+	p := SocketProbe{Addr: ln.Addr().String(), Network: "tcp", Timeout: time.Second, Send: []byte("PING\r\n")}
+	p.Expect = []byte("+PONG")
+	assert.NoError(t, p.Probe())
+	p.ExpectRegexp = regexp.MustCompile(`^\+PONG\r\n$`)
+	assert.NoError(t, p.Probe())
+
+	p.Send = []byte("QUIT\r\n")
+	assert.ErrorContains(t, p.Probe(), "does not match")
+
+	// a peer never answering does not block the probe without timeout
+	silent, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer silent.Close()
+	p = SocketProbe{Addr: silent.Addr().String(), Network: "tcp", Expect: []byte("+PONG")}
+	start := time.Now()
+	assert.Error(t, p.Probe())
+	assert.Less(t, time.Since(start), defaultProbeTimeout+time.Second)
+}
+
+func TestHTTPProbeAssertions(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("X-Token") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"status":"UP","count":1000000,"deps":[{"name":"db","up":true}]}`))
+	}))
+	defer srv.Close()
+
+	p := HTTPProbe{URL: srv.URL, Timeout: time.Second, Method: http.MethodPost, Header: http.Header{"X-Token": {"secret"}}}
+	assert.ErrorContains(t, p.Probe(), "'202'", "200 only by default")
+
+	p.Status = []StatusRange{{200, 299}}
+	assert.NoError(t, p.Probe())
+	p.BodyRegexp = regexp.MustCompile(`"status":"UP"`)
+	assert.NoError(t, p.Probe())
+	p.JSON = map[string]string{"status": "UP", "deps.0.up": "true", "deps.0.name": ""}
+	assert.NoError(t, p.Probe())
+	p.JSON = map[string]string{"count": "1000000"}
+	assert.NoError(t, p.Probe(), "the numbers are not formatted in the exponent")
+
+	p.JSON = map[string]string{"deps.1.name": ""}
+	assert.ErrorContains(t, p.Probe(), "not found")
+	p.JSON = map[string]string{"deps.0.up": "false"}
+	assert.ErrorContains(t, p.Probe(), "expect 'false'")
+	p.JSON = nil
+	p.BodyRegexp = regexp.MustCompile(`DOWN`)
+	assert.ErrorContains(t, p.Probe(), "does not match")
+
+	p = HTTPProbe{URL: srv.URL, Timeout: time.Second, Status: []StatusRange{{200, 299}}}
+	assert.ErrorContains(t, p.Probe(), "'401'")
+
+	// the certificate of the test server is self signed
+	tlsSrv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tlsSrv.Close()
+	assert.Error(t, HTTPProbe{URL: tlsSrv.URL, Timeout: time.Second}.Probe())
+	assert.NoError(t, HTTPProbe{URL: tlsSrv.URL, Timeout: time.Second, InsecureSkipVerify: true}.Probe())
+	assert.NoError(t, HTTPProbe{URL: tlsSrv.URL, Timeout: time.Second, TLSConfig: tlsSrv.Client().Transport.(*http.Transport).TLSClientConfig}.Probe())
+}
+
+func TestExecProbe(t *testing.T) {
+	assert.NoError(t, ExecProbe{Command: "sh", Args: []string{"-c", "echo $GREETING"}, Env: []string{"GREETING=ok"},
+		ExpectOutput: regexp.MustCompile(`^ok\n$`)}.Probe())
+	assert.ErrorContains(t, ExecProbe{Command: "sh", Args: []string{"-c", "echo broken; exit 3"}}.Probe(), "broken")
+	assert.ErrorContains(t, ExecProbe{Command: "echo", Args: []string{"ko"}, ExpectOutput: regexp.MustCompile(`ok`)}.Probe(), "does not match")
+	assert.Error(t, ExecProbe{Command: "sleep", Args: []string{"5"}, Timeout: 50 * time.Millisecond}.Probe())
+}
+
+func TestDNSProbe(t *testing.T) {
+	assert.NoError(t, DNSProbe{Host: "localhost", Network: "ip4", Timeout: time.Second, Expect: []string{"127.0.0.1"}}.Probe())
+	assert.ErrorContains(t, DNSProbe{Host: "localhost", Network: "ip4", Timeout: time.Second, Expect: []string{"10.0.0.1"}}.Probe(), "expect '10.0.0.1'")
+	assert.Error(t, DNSProbe{Host: "nonexistent.invalid", Timeout: time.Second}.Probe())
+}
+
+func TestProbeKeepalive(t *testing.T) {
+	// the probes feed the evaluaters through the background keepalive
+	ka := NewKeepalive(NewCounterEvaluater(2, 2), ExecProbe{Command: "false"}, xlog.NopPrinter{})
+	cancel := ka.Background(10 * time.Millisecond)
+	defer cancel()
+	assert.Eventually(t, func() bool { return !ka.Alive() }, 3*time.Second, 50*time.Millisecond)
+}
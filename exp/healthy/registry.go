@@ -0,0 +1,265 @@
+package healthy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	ErrNotAlive     = errors.New("keepalive is not alive")
+	ErrDuplicated   = errors.New("check is registered already")
+	ErrCyclicDepend = errors.New("check depends on itself")
+)
+
+// ProbeFunc adapts a function to Liveness
+type ProbeFunc func() error
+
+func (f ProbeFunc) Probe() error { return f() }
+
+// KeepaliveProbe reports the state of the keepalive as a Liveness, so a keepalive can be registered as a check
+func KeepaliveProbe(ka Keepalive) Liveness {
+	return ProbeFunc(func() error {
+		if !ka.Alive() {
+			return ErrNotAlive
+		}
+		return nil
+	})
+}
+
+// Check is a named health check of a component
+type Check struct {
+	Name     string
+	Probe    Liveness
+	Critical bool          // a failed critical check fails the aggregation, a failed optional check is reported only
+	Live     bool          // the check takes part in the liveness as well, it is a readiness check only by default
+	Timeout  time.Duration // a probe taking longer fails, default 3s
+	TTL      time.Duration // the result is cached for so long, 0 probes on every aggregation
+	// DependsOn are the names of the checks this one relies on,
+	// the check is not probed and regarded as failed while any of them fails.
+	DependsOn []string
+}
+
+// Result is the outcome of a check
+type Result struct {
+	Name     string        `json:"name"`
+	Healthy  bool          `json:"healthy"`
+	Critical bool          `json:"critical"`
+	Cached   bool          `json:"cached,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Time     time.Time     `json:"time"`
+	Duration time.Duration `json:"-"`
+}
+
+func (r Result) MarshalJSON() ([]byte, error) {
+	type result Result
+	return json.Marshal(struct {
+		result
+		Duration string `json:"duration"`
+	}{result(r), r.Duration.String()})
+}
+
+// Report is the aggregation of the checks
+type Report struct {
+	Healthy bool     `json:"healthy"` // all the critical checks succeed
+	Checks  []Result `json:"checks"`  // in order of the names
+}
+
+type entry struct {
+	Check
+	mu   sync.Mutex
+	last Result
+}
+
+// probe runs the probe bounded by the timeout, the result is cached for TTL
+func (e *entry) probe() Result {
+	e.mu.Lock()
+	if e.TTL > 0 && !e.last.Time.IsZero() && time.Since(e.last.Time) < e.TTL {
+		res := e.last
+		e.mu.Unlock()
+		res.Cached = true
+		return res
+	}
+	e.mu.Unlock()
+
+	ch := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				ch <- errors.Errorf("probe panic: %v", r)
+			}
+		}()
+		ch <- e.Probe.Probe()
+	}()
+
+	start := time.Now()
+	timer := time.NewTimer(e.Timeout)
+	defer timer.Stop()
+	var err error
+	select {
+	case err = <-ch:
+	case <-timer.C:
+		err = errors.Errorf("probe timeout after %v", e.Timeout)
+	}
+
+	res := Result{Name: e.Name, Healthy: err == nil, Critical: e.Critical, Time: start, Duration: time.Since(start)}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	e.mu.Lock()
+	e.last = res
+	e.mu.Unlock()
+	return res
+}
+
+// Registry aggregates the health checks of the components
+type Registry struct {
+	mu     sync.RWMutex
+	checks map[string]*entry
+	group  singleflight.Group // concurrent aggregations share the probes in flight
+}
+
+func NewRegistry() *Registry {
+	return &Registry{checks: map[string]*entry{}}
+}
+
+// Register adds the check, the names are unique and the dependencies must not be cyclic.
+// A dependency may be registered later, it fails until then.
+func (r *Registry) Register(c Check) error {
+	if c.Timeout <= 0 {
+		c.Timeout = 3 * time.Second
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.checks[c.Name]; ok {
+		return errors.Wrapf(ErrDuplicated, "check '%s'", c.Name)
+	}
+
+	// walk the dependencies looking for the new check
+	visited := map[string]bool{}
+	var walk func(deps []string) bool
+	walk = func(deps []string) bool {
+		for _, dep := range deps {
+			if dep == c.Name {
+				return true
+			}
+			if visited[dep] {
+				continue
+			}
+			visited[dep] = true
+			if e, ok := r.checks[dep]; ok && walk(e.DependsOn) {
+				return true
+			}
+		}
+		return false
+	}
+	if walk(c.DependsOn) {
+		return errors.Wrapf(ErrCyclicDepend, "check '%s'", c.Name)
+	}
+
+	r.checks[c.Name] = &entry{Check: c}
+	return nil
+}
+
+// Unregister removes the check
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.checks, name)
+}
+
+// Live aggregates the liveness checks
+func (r *Registry) Live(ctx context.Context) Report {
+	return r.aggregate(ctx, func(e *entry) bool { return e.Live })
+}
+
+// Ready aggregates all the checks
+func (r *Registry) Ready(ctx context.Context) Report {
+	return r.aggregate(ctx, func(e *entry) bool { return true })
+}
+
+// evaluation resolves every check at most once during an aggregation
+type evaluation struct {
+	ctx     context.Context
+	r       *Registry
+	checks  map[string]*entry
+	once    map[string]*sync.Once
+	results map[string]*Result
+}
+
+func (ev *evaluation) result(name string) Result {
+	once, ok := ev.once[name]
+	if !ok {
+		return Result{Name: name, Error: "check is not registered", Time: time.Now()}
+	}
+
+	once.Do(func() {
+		e := ev.checks[name]
+		for _, dep := range e.DependsOn {
+			if res := ev.result(dep); !res.Healthy {
+				*ev.results[name] = Result{Name: name, Critical: e.Critical, Time: time.Now(),
+					Error: fmt.Sprintf("dependency '%s' is unhealthy: %s", dep, res.Error)}
+				return
+			}
+		}
+
+		ch := ev.r.group.DoChan(name, func() (any, error) { return e.probe(), nil })
+		select {
+		case v := <-ch:
+			*ev.results[name] = v.Val.(Result)
+		case <-ev.ctx.Done():
+			*ev.results[name] = Result{Name: name, Critical: e.Critical, Time: time.Now(), Error: ev.ctx.Err().Error()}
+		}
+	})
+	return *ev.results[name]
+}
+
+func (r *Registry) aggregate(ctx context.Context, include func(*entry) bool) Report {
+	r.mu.RLock()
+	ev := &evaluation{
+		ctx:     ctx,
+		r:       r,
+		checks:  make(map[string]*entry, len(r.checks)),
+		once:    make(map[string]*sync.Once, len(r.checks)),
+		results: make(map[string]*Result, len(r.checks)),
+	}
+	for name, e := range r.checks {
+		ev.checks[name] = e
+		ev.once[name] = &sync.Once{}
+		ev.results[name] = &Result{}
+	}
+	r.mu.RUnlock()
+
+	var names []string
+	for name, e := range ev.checks {
+		if include(e) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	report := Report{Healthy: true, Checks: make([]Result, len(names))}
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Checks[i] = ev.result(name)
+		}()
+	}
+	wg.Wait()
+
+	for _, res := range report.Checks {
+		if res.Critical && !res.Healthy {
+			report.Healthy = false
+		}
+	}
+	return report
+}
@@ -0,0 +1,123 @@
+package healthy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	var dbDown atomic.Bool
+	dbDown.Store(true)
+	r := NewRegistry()
+	assert.NoError(t, r.Register(Check{Name: "process", Probe: ProbeFunc(func() error { return nil }), Critical: true, Live: true}))
+	assert.NoError(t, r.Register(Check{Name: "db", Probe: ProbeFunc(func() error {
+		if dbDown.Load() {
+			return errNoop
+		}
+		return nil
+	}), Critical: true}))
+	assert.NoError(t, r.Register(Check{Name: "cache", Probe: ProbeFunc(func() error { return errNoop })}))
+	assert.ErrorIs(t, r.Register(Check{Name: "db"}), ErrDuplicated)
+
+	live := r.Live(context.Background())
+	assert.True(t, live.Healthy)
+	assert.Len(t, live.Checks, 1)
+
+	// the failed optional check does not fail the readiness
+	ready := r.Ready(context.Background())
+	assert.False(t, ready.Healthy)
+	assert.Equal(t, []string{"cache", "db", "process"}, names(ready))
+	assert.Equal(t, errNoop.Error(), ready.Checks[1].Error)
+
+	dbDown.Store(false)
+	ready = r.Ready(context.Background())
+	assert.True(t, ready.Healthy)
+	assert.False(t, ready.Checks[0].Healthy)
+
+	r.Unregister("cache")
+	assert.Equal(t, []string{"db", "process"}, names(r.Ready(context.Background())))
+}
+
+func names(r Report) []string {
+	var ns []string
+	for _, res := range r.Checks {
+		ns = append(ns, res.Name)
+	}
+	return ns
+}
+
+func TestRegistryDependency(t *testing.T) {
+	var probed atomic.Int64
+	r := NewRegistry()
+	assert.NoError(t, r.Register(Check{Name: "api", DependsOn: []string{"db"}, Critical: true,
+		Probe: ProbeFunc(func() error { probed.Add(1); return nil })}))
+
+	// an unregistered dependency fails
+	report := r.Ready(context.Background())
+	assert.False(t, report.Healthy)
+	assert.Contains(t, report.Checks[0].Error, "dependency 'db' is unhealthy")
+	assert.EqualValues(t, 0, probed.Load())
+
+	assert.ErrorIs(t, r.Register(Check{Name: "db", DependsOn: []string{"api"}}), ErrCyclicDepend)
+	assert.NoError(t, r.Register(Check{Name: "db", Probe: ProbeFunc(func() error { return nil })}))
+	assert.True(t, r.Ready(context.Background()).Healthy)
+	assert.EqualValues(t, 1, probed.Load())
+}
+
+func TestRegistryTimeoutAndCache(t *testing.T) {
+	var probed atomic.Int64
+	r := NewRegistry()
+	assert.NoError(t, r.Register(Check{Name: "slow", Critical: true, Timeout: 20 * time.Millisecond,
+		Probe: ProbeFunc(func() error { time.Sleep(time.Second); return nil })}))
+	assert.NoError(t, r.Register(Check{Name: "cached", TTL: time.Minute,
+		Probe: ProbeFunc(func() error { probed.Add(1); return nil })}))
+
+	start := time.Now()
+	report := r.Ready(context.Background())
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.False(t, report.Healthy)
+	assert.Contains(t, report.Checks[1].Error, "timeout")
+
+	report = r.Ready(context.Background())
+	assert.True(t, report.Checks[0].Cached)
+	assert.EqualValues(t, 1, probed.Load())
+
+	// the keepalive is a check as well
+	ev := &fakeEvaluater{}
+	assert.NoError(t, r.Register(Check{Name: "ka", Live: true, Critical: true,
+		Probe: KeepaliveProbe(NewKeepalive(ev, &fakeLiveness{}, nil))}))
+	assert.False(t, r.Live(context.Background()).Healthy)
+}
+
+func TestRegistryHandler(t *testing.T) {
+	r := NewRegistry()
+	assert.NoError(t, r.Register(Check{Name: "process", Live: true, Critical: true, Probe: ProbeFunc(func() error { return nil })}))
+	assert.NoError(t, r.Register(Check{Name: "db", Critical: true, Probe: ProbeFunc(func() error { return errNoop })}))
+
+	rec := httptest.NewRecorder()
+	r.LivezHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	rec = httptest.NewRecorder()
+	r.ReadyzHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	var body struct {
+		Healthy bool
+		Checks  []map[string]any
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.False(t, body.Healthy)
+	assert.Len(t, body.Checks, 2)
+	assert.Equal(t, "db", body.Checks[0]["name"])
+	assert.Equal(t, errNoop.Error(), body.Checks[0]["error"])
+	assert.NotEmpty(t, body.Checks[0]["duration"])
+}
@@ -0,0 +1,147 @@
+package hystrix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// commands is the registry of the named commands, like hystrix-go
+var commands = struct {
+	sync.RWMutex
+	configs  map[string]Config
+	circuits map[string]*Hystrix
+}{
+	configs:  map[string]Config{},
+	circuits: map[string]*Hystrix{},
+}
+
+// ConfigureCommand applies the config to the named command.
+// The circuit of the command is created on its first use with the config,
+// a running circuit keeps its settings since they are read by the commands in flight without a lock.
+func ConfigureCommand(name string, cfg Config) {
+	commands.Lock()
+	defer commands.Unlock()
+	commands.configs[name] = cfg
+}
+
+// Configure applies the configs to the named commands
+func Configure(cfgs map[string]Config) {
+	for name, cfg := range cfgs {
+		ConfigureCommand(name, cfg)
+	}
+}
+
+// GetCircuit returns the circuit of the named command, it is created by the config of the command
+// or by NewConfig if the command is not configured.
+func GetCircuit(name string) *Hystrix {
+	commands.RLock()
+	h, ok := commands.circuits[name]
+	commands.RUnlock()
+	if ok {
+		return h
+	}
+
+	commands.Lock()
+	defer commands.Unlock()
+	if h, ok := commands.circuits[name]; ok {
+		return h
+	}
+
+	cfg, ok := commands.configs[name]
+	if !ok {
+		cfg = NewConfig()
+	}
+	h = NewHystrix(cfg)
+	commands.circuits[name] = h
+	return h
+}
+
+// Circuits returns the names of the commands whose circuit is created, in order
+func Circuits() []string {
+	commands.RLock()
+	defer commands.RUnlock()
+	names := make([]string, 0, len(commands.circuits))
+	for name := range commands.circuits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Flush drops all the commands and their circuits
+func Flush() {
+	commands.Lock()
+	defer commands.Unlock()
+	commands.configs = map[string]Config{}
+	commands.circuits = map[string]*Hystrix{}
+}
+
+// withFallback calls the fallback if the command is rejected or timeout
+func withFallback(err error, fallback func(error) error) error {
+	if fallback == nil {
+		return err
+	}
+	if !errors.Is(err, ErrCircuitOpen) && !errors.Is(err, ErrMaxConcurrency) && !errors.Is(err, ErrTimeout) {
+		return err
+	}
+
+	if ferr := fallback(err); ferr != nil {
+		return fmt.Errorf("hystrix: fallback failed with '%w', run error was '%v'", ferr, err)
+	}
+	return nil
+}
+
+// GoWithFallback runs your function like Go, the fallback is called once the circuit is open,
+// the max concurrency is reached or the function takes too long.
+// The error of the fallback is returned, other errors of the function are returned as is.
+func (h *Hystrix) GoWithFallback(name string, runnable func() error, fallback func(error) error) chan error {
+	errchan := make(chan error, 1)
+	ch := h.Go(name, runnable)
+	go func() { errchan <- withFallback(<-ch, fallback) }()
+	return errchan
+}
+
+// DoWithFallback runs your function like Do, the fallback is called once the circuit is open,
+// the max concurrency is reached or the function takes too long.
+func (h *Hystrix) DoWithFallback(name string, runnable func() error, fallback func(error) error) error {
+	return withFallback(h.Do(name, runnable), fallback)
+}
+
+// DoCWithFallback runs your function like DoC, the fallback is called once the circuit is open,
+// the max concurrency is reached or the function takes too long.
+func (h *Hystrix) DoCWithFallback(ctx context.Context, name string, runnable func(context.Context) error, fallback func(error) error) error {
+	return withFallback(h.DoC(ctx, name, runnable), fallback)
+}
+
+// Go runs your function on the circuit of the named command
+func Go(name string, runnable func() error) chan error {
+	return GetCircuit(name).Go(name, runnable)
+}
+
+// Do runs your function on the circuit of the named command, blocking until it is done
+func Do(name string, runnable func() error) error {
+	return GetCircuit(name).Do(name, runnable)
+}
+
+// DoC runs your function on the circuit of the named command, blocking until it is done
+func DoC(ctx context.Context, name string, runnable func(context.Context) error) error {
+	return GetCircuit(name).DoC(ctx, name, runnable)
+}
+
+// GoWithFallback runs your function on the circuit of the named command, see Hystrix.GoWithFallback
+func GoWithFallback(name string, runnable func() error, fallback func(error) error) chan error {
+	return GetCircuit(name).GoWithFallback(name, runnable, fallback)
+}
+
+// DoWithFallback runs your function on the circuit of the named command, see Hystrix.DoWithFallback
+func DoWithFallback(name string, runnable func() error, fallback func(error) error) error {
+	return GetCircuit(name).DoWithFallback(name, runnable, fallback)
+}
+
+// DoCWithFallback runs your function on the circuit of the named command, see Hystrix.DoCWithFallback
+func DoCWithFallback(ctx context.Context, name string, runnable func(context.Context) error, fallback func(error) error) error {
+	return GetCircuit(name).DoCWithFallback(ctx, name, runnable, fallback)
+}
@@ -0,0 +1,88 @@
+package hystrix
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandRegistry(t *testing.T) {
+	defer Flush()
+
+	cfg := NewConfig()
+	cfg.MaxConcurrency.Update(3)
+	ConfigureCommand("a", cfg)
+
+	a := GetCircuit("a")
+	assert.Same(t, a, GetCircuit("a"))
+	assert.EqualValues(t, 3, a.assigner.Available())
+	assert.EqualValues(t, DefaultMaxConcurrency, GetCircuit("b").assigner.Available())
+	assert.Equal(t, []string{"a", "b"}, Circuits())
+
+	// a running circuit keeps its settings, the config applies to the circuits created later
+	cfg.MaxConcurrency.Update(5)
+	Configure(map[string]Config{"a": cfg, "c": cfg})
+	assert.Same(t, a, GetCircuit("a"))
+	assert.EqualValues(t, 3, a.assigner.Available())
+	assert.EqualValues(t, 5, GetCircuit("c").assigner.Available())
+
+	// circuits are isolated by name
+	GetCircuit("a").Trigger(true)
+	assert.Equal(t, ErrCircuitOpen, Do("a", func() error { return nil }))
+	assert.NoError(t, Do("b", func() error { return nil }))
+	assert.NoError(t, <-Go("b", func() error { return nil }))
+	assert.NoError(t, DoC(context.Background(), "b", func(context.Context) error { return nil }))
+
+	Flush()
+	assert.Empty(t, Circuits())
+	assert.NotSame(t, a, GetCircuit("a"))
+}
+
+func TestFallback(t *testing.T) {
+	defer Flush()
+
+	var got error
+	fallback := func(err error) error { got = err; return nil }
+
+	// errors of the function are not handled by the fallback
+	assert.Equal(t, net.ErrClosed, DoWithFallback("fb", func() error { return net.ErrClosed }, fallback))
+	assert.NoError(t, got)
+
+	GetCircuit("fb").Trigger(true)
+	assert.NoError(t, DoWithFallback("fb", func() error { return nil }, fallback))
+	assert.Equal(t, ErrCircuitOpen, got)
+	assert.NoError(t, <-GoWithFallback("fb", func() error { return nil }, fallback))
+
+	// the error of the fallback is returned
+	err := DoCWithFallback(context.Background(), "fb", func(context.Context) error { return nil },
+		func(error) error { return net.ErrClosed })
+	assert.ErrorIs(t, err, net.ErrClosed)
+	assert.Contains(t, err.Error(), ErrCircuitOpen.Error())
+
+	// timeout
+	cfg := NewConfig()
+	cfg.Timeout.Update(10 * time.Millisecond)
+	ConfigureCommand("slow", cfg)
+	release, done := make(chan struct{}), make(chan struct{})
+	assert.NoError(t, DoWithFallback("slow", func() error { defer close(done); <-release; return nil }, fallback))
+	assert.Equal(t, ErrTimeout, got)
+	// the function outlives the timeout, wait for it before the test returns
+	close(release)
+	<-done
+	assert.Eventually(t, func() bool { return GetCircuit("slow").Statistic().Concurrency == 0 },
+		time.Second, time.Millisecond)
+
+	// max concurrency
+	h := NewHystrix(NewConfig())
+	h.MaxConcurrency.Update(1)
+	block := make(chan struct{})
+	ch := h.Go("busy", func() error { <-block; return nil })
+	assert.NoError(t, h.DoWithFallback("busy", func() error { return nil }, fallback))
+	assert.True(t, errors.Is(got, ErrMaxConcurrency))
+	close(block)
+	assert.NoError(t, <-ch)
+}
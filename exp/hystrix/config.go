@@ -19,6 +19,12 @@ var (
 	DefaultMinQPSNum = 20
 	// DefaultErrorPercentThreshold causes circuits to open once the rolling measure of errors exceeds this percent of requests
 	DefaultFailureThreshold = 20 // 0~100
+	// DefaultHalfOpenCalls is how many test requests can run at the same time when the circuitbreaker is half-open
+	DefaultHalfOpenCalls = 1
+	// DefaultSlowCallDuration is how long a call takes to count as a slow call, 0 disables the slow call checking
+	DefaultSlowCallDuration time.Duration = 0
+	// DefaultSlowCallThreshold causes circuits to open once the rolling measure of slow calls exceeds this percent of requests
+	DefaultSlowCallThreshold = 100 // 0~100
 )
 
 type Base[T any] struct{ val T }
@@ -74,6 +80,9 @@ type Config struct {
 	MaxConcurrency    Mutable[int]           `json:"max_concurrency"`
 	MinQPSThreshold   Mutable[int]           `json:"min_qps_threshold"`
 	FailureThreshold  Mutable[int]           `json:"failure_threshold"` // 0~100
+	HalfOpenCalls     Mutable[int]           `json:"half_open_calls"`
+	SlowCallDuration  Mutable[time.Duration] `json:"slow_call_duration"`  // ms
+	SlowCallThreshold Mutable[int]           `json:"slow_call_threshold"` // 0~100
 }
 
 func NewConfig() Config {
@@ -102,5 +111,17 @@ func NewConfig() Config {
 			Val:       Base[int]{val: DefaultFailureThreshold},
 			Validator: Base[func(v int) bool]{val: func(v int) bool { return v >= 0 && v <= 100 }},
 		},
+		HalfOpenCalls: Mutable[int]{
+			Val:       Base[int]{val: DefaultHalfOpenCalls},
+			Validator: Base[func(v int) bool]{val: func(v int) bool { return v >= 1 }},
+		},
+		SlowCallDuration: Mutable[time.Duration]{
+			Val:       Base[time.Duration]{val: DefaultSlowCallDuration},
+			Validator: Base[func(v time.Duration) bool]{val: func(v time.Duration) bool { return v >= 0 }},
+		},
+		SlowCallThreshold: Mutable[int]{
+			Val:       Base[int]{val: DefaultSlowCallThreshold},
+			Validator: Base[func(v int) bool]{val: func(v int) bool { return v >= 0 && v <= 100 }},
+		},
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -29,27 +30,39 @@ const (
 
 type Hystrix struct {
 	Config
-	lastTestAt    atomic.Int64 // last single test timestamp in nanoseconds
-	isOpen        atomic.Bool  // circuit state
+	state         atomic.Int32 // circuit state
+	halfOpenCalls atomic.Int32 // test requests in flight when half-open
 	isForceOpen   atomic.Bool  // manually turn on/off the circuit
 	assigner      *Assigner    // for concurrency control
+	limiter       atomic.Pointer[limiterBox]
 	posiStat      *rolling.SlidingWindow
 	negaStat      *rolling.SlidingWindow
+	slowStat      *rolling.SlidingWindow
+	rejectStat    *rolling.SlidingWindow // rejected by the circuit or the concurrency
+	timeoutStat   *rolling.SlidingWindow
+	latencies     *latencies
 	recovery      *recovery
 	logger        xlog.Printer
 	stateChangeAt atomic.Int64 // state change timestamp in nanoseconds
+	mu            sync.RWMutex
+	listeners     []func(from, to State)
 }
 
 func NewHystrix(cfg Config) *Hystrix {
 	h := &Hystrix{
-		Config:   cfg,
-		assigner: &Assigner{maxCount: cfg.MaxConcurrency.Val.Get()},
-		posiStat: rolling.NewSlidingWindow(128),
-		negaStat: rolling.NewSlidingWindow(128),
-		recovery: newRecovery(cfg.KeepAliveProbes.Val.Get()),
-		logger:   xlog.NopPrinter{},
+		Config:      cfg,
+		assigner:    &Assigner{maxCount: cfg.MaxConcurrency.Val.Get()},
+		posiStat:    rolling.NewSlidingWindow(128),
+		negaStat:    rolling.NewSlidingWindow(128),
+		slowStat:    rolling.NewSlidingWindow(128),
+		rejectStat:  rolling.NewSlidingWindow(128),
+		timeoutStat: rolling.NewSlidingWindow(128),
+		latencies:   newLatencies(_LATENCY_WIN_SIZE),
+		recovery:    newRecovery(cfg.KeepAliveProbes.Val.Get()),
+		logger:      xlog.NopPrinter{},
 	}
 	h.MaxConcurrency.OnUpdate.Set(func(v int) { h.assigner.Resize(v) })
+	h.limiter.Store(&limiterBox{assignerLimiter{h.assigner}})
 	h.stateChangeAt.Store(timex.UnixNano())
 
 	return h
@@ -58,31 +71,36 @@ func NewHystrix(cfg Config) *Hystrix {
 type Statistic struct {
 	Concurrency   int     // 并发数
 	FailRate      float64 // 0~100
+	SlowRate      float64 // 0~100, 慢调用比例
 	QPS           float64 // 3s 内的 QPS
 	StateDuration float64 // 熔断器当前状态持续时间（毫秒）
-	IsOpen        bool    // 熔断器是否开启
+	IsOpen        bool    // 熔断器是否开启, 半开也算开启
+	State         State   // 熔断器状态
 }
 
 func (h *Hystrix) Statistic() Statistic {
 	nsec := timex.UnixNano()
 	stateDuration := float64(nsec-h.stateChangeAt.Load()) / float64(time.Millisecond)
 
+	state := h.State()
 	return Statistic{
-		Concurrency:   h.assigner.Allocated(),
+		Concurrency:   h.getLimiter().Allocated(),
 		FailRate:      h.failRate(nsec),
+		SlowRate:      h.slowRate(nsec),
 		QPS:           h.qps(nsec),
 		StateDuration: stateDuration,
-		IsOpen:        h.isOpen.Load(),
+		IsOpen:        state != StateClosed,
+		State:         state,
 	}
 }
 
 func (s Statistic) String() string {
-	state := "closed"
-	if s.IsOpen {
-		state = "open"
+	state := s.State
+	if s.IsOpen && state == StateClosed {
+		state = StateOpen
 	}
-	return fmt.Sprintf("{State: %s, Concurrency: %d, FailRate: %.2f%%, QPS: %.2f, Duration: %.1fms}",
-		state, s.Concurrency, s.FailRate, s.QPS, s.StateDuration)
+	return fmt.Sprintf("{State: %s, Concurrency: %d, FailRate: %.2f%%, SlowRate: %.2f%%, QPS: %.2f, Duration: %.1fms}",
+		state, s.Concurrency, s.FailRate, s.SlowRate, s.QPS, s.StateDuration)
 }
 
 // open or close the circuitbreaker manually
@@ -106,33 +124,43 @@ func (h *Hystrix) failRate(nsec int64) float64 {
 	return errPct
 }
 
+func (h *Hystrix) slowRate(nsec int64) float64 {
+	var slowPct float64
+	v0, _ := h.posiStat.At(nsec).Estimate(_COUNTER_WIN_SIZE)
+	v1, _ := h.negaStat.At(nsec).Estimate(_COUNTER_WIN_SIZE)
+	v2, _ := h.slowStat.At(nsec).Estimate(_COUNTER_WIN_SIZE)
+	if v0+v1 > 0 {
+		slowPct = float64(v2*100) / float64(v0+v1)
+	}
+	return slowPct
+}
+
+// isSlow tells whether the call counts as a slow call
+func (h *Hystrix) isSlow(latency time.Duration) bool {
+	d := h.SlowCallDuration.Val.Get()
+	return d > 0 && latency > d
+}
+
 func (h *Hystrix) allowRequest() (allow, singletest bool) {
 	if h.isForceOpen.Load() {
 		return false, false
 	}
 
 	nsec := timex.UnixNano()
-	if h.isOpen.Load() {
-		// recovery?
-		// Only check recovery status if we have enough probe data
-		if h.recovery.IsHealthy() {
-			h.trigger(false)
-			return true, false
-		}
-
-		// single test should be applied when circuit is opened
-		lastTestAt := h.lastTestAt.Load()
-		keepAliveInterval := h.KeepAliveInterval.Val.Get().Nanoseconds()
-
-		if nsec >= lastTestAt+keepAliveInterval {
-			swapped := h.lastTestAt.CompareAndSwap(lastTestAt, nsec)
-			if swapped {
-				h.logger.Printf("hystrix-go: allowing single test.")
-				return true, true
-			}
+	switch h.State() {
+	case StateOpen:
+		// the circuit stays open for KeepAliveInterval, then it is half-open
+		if nsec < h.stateChangeAt.Load()+h.KeepAliveInterval.Val.Get().Nanoseconds() {
 			return false, false
 		}
+		h.transit(StateOpen, StateHalfOpen)
+		fallthrough
 
+	case StateHalfOpen:
+		if h.acquireHalfOpen() {
+			h.logger.Printf("hystrix-go: allowing single test.")
+			return true, true
+		}
 		return false, false
 	}
 
@@ -141,36 +169,16 @@ func (h *Hystrix) allowRequest() (allow, singletest bool) {
 		return true, false
 	}
 
-	// too many failures, open the circuitbreaker
-	if int(h.failRate(nsec)) >= h.FailureThreshold.Val.Get() {
-		h.trigger(true)
+	// too many failures or slow calls, open the circuitbreaker
+	if int(h.failRate(nsec)) >= h.FailureThreshold.Val.Get() ||
+		h.SlowCallDuration.Val.Get() > 0 && int(h.slowRate(nsec)) >= h.SlowCallThreshold.Val.Get() {
+		h.transit(StateClosed, StateOpen)
 		return false, false
 	}
 
 	return true, false
 }
 
-func (h *Hystrix) trigger(open bool) {
-	if open {
-		if h.isOpen.CompareAndSwap(false, true) {
-			now := timex.UnixNano()
-			h.stateChangeAt.Store(now)
-			h.lastTestAt.Store(now)
-			h.logger.Printf("hystrix-go: opening circuitbreaker. Stats: %s", h.Statistic())
-			// Don't reset immediately - let old data expire naturally
-			// This prevents race with concurrent feedback() calls
-		}
-	} else {
-		if h.isOpen.CompareAndSwap(true, false) {
-			h.stateChangeAt.Store(timex.UnixNano())
-			h.logger.Printf("hystrix-go: closing circuitbreaker. Recovery status: %s", h.recovery)
-			h.recovery.Reset()
-			h.posiStat.Reset() // Safe to reset here after circuit closes
-			h.negaStat.Reset()
-		}
-	}
-}
-
 type snapshot struct {
 	err       error
 	isTestReq bool
@@ -180,28 +188,31 @@ type snapshot struct {
 
 func (h *Hystrix) feedback(s snapshot) {
 	nsec := s.stopNano
-	latency := float64(nsec-s.startNano) / float64(time.Millisecond)
+	latency := time.Duration(nsec - s.startNano)
+	slow := h.isSlow(latency)
 
-	if h.isOpen.Load() && s.isTestReq {
-		h.recovery.Update(s.err == nil)
-		// record single test request result
-		if s.err == nil {
+	if s.isTestReq {
+		h.releaseHalfOpen()
+	}
+	if s.isTestReq && h.State() == StateHalfOpen {
+		// a slow test request fails the recovery as well
+		h.recovery.Update(s.err == nil && !slow)
+		if s.err == nil && !slow {
 			h.logger.Printf("hystrix-go: single test request succeeded. Latency: %.2fms. Recovery status: %s",
-				latency, h.recovery)
+				float64(latency)/float64(time.Millisecond), h.recovery)
 		} else {
-			h.logger.Printf("hystrix-go: single test request failed: %v. Latency: %.2fms. Recovery status: %s",
-				s.err, latency, h.recovery)
+			h.logger.Printf("hystrix-go: single test request failed: %v, slow: %v. Latency: %.2fms. Recovery status: %s",
+				s.err, slow, float64(latency)/float64(time.Millisecond), h.recovery)
 		}
-	}
 
-	// record circuitbreaker state change
-	currentErrRate := h.failRate(nsec)
-	threshold := float64(h.FailureThreshold.Val.Get())
-	shouldOpen := currentErrRate >= threshold
-
-	if h.isOpen.Load() != shouldOpen {
-		h.logger.Printf("hystrix-go: circuit state change detected - Current: %v, ShouldOpen: %v, ErrorRate: %.2f%%, Threshold: %.0f%%, QPS: %.2f",
-			h.isOpen.Load(), shouldOpen, currentErrRate, threshold, h.qps(nsec))
+		// enough test requests, close or reopen the circuitbreaker
+		if h.recovery.Full() {
+			if h.recovery.IsHealthy() {
+				h.transit(StateHalfOpen, StateClosed)
+			} else {
+				h.transit(StateHalfOpen, StateOpen)
+			}
+		}
 	}
 
 	// update statistics
@@ -210,6 +221,17 @@ func (h *Hystrix) feedback(s snapshot) {
 	} else {
 		h.negaStat.At(nsec).IncrBy(1)
 	}
+	if slow {
+		h.slowStat.At(nsec).IncrBy(1)
+	}
+	switch s.err {
+	case ErrCircuitOpen, ErrMaxConcurrency:
+		h.rejectStat.At(nsec).IncrBy(1)
+		return
+	case ErrTimeout:
+		h.timeoutStat.At(nsec).IncrBy(1)
+	}
+	h.latencies.Add(latency)
 }
 
 type singleTestMeta struct{}
@@ -218,7 +240,7 @@ type singleTestMeta struct{}
 // If your function begins slowing down or failing repeatedly, we will block
 // new calls to it for you to give the dependent service time to repair.
 //
-// Define a fallback function if you want to define some code to execute during outages.
+// Use GoWithFallback if you want to define some code to execute during outages.
 func (h *Hystrix) GoC(ctx context.Context, runable func(context.Context) error) chan error {
 	nanosec := timex.UnixNano()
 	errchan := make(chan error, 1)
@@ -230,7 +252,8 @@ func (h *Hystrix) GoC(ctx context.Context, runable func(context.Context) error)
 		return errchan
 	}
 
-	if !h.assigner.TryAcquire() {
+	limiter := h.getLimiter()
+	if !limiter.TryAcquire() {
 		h.feedback(snapshot{ErrMaxConcurrency, false, nanosec, nanosec})
 		errchan <- ErrMaxConcurrency
 		return errchan
@@ -253,8 +276,9 @@ func (h *Hystrix) GoC(ctx context.Context, runable func(context.Context) error)
 	}()
 
 	go func() {
+		var outcome snapshot
 		defer func() {
-			h.assigner.Release()
+			limiter.Release(time.Duration(outcome.stopNano-outcome.startNano), outcome.err == ErrTimeout)
 			if r := recover(); r != nil {
 				h.logger.Printf("hystrix-go: panic when waitting execute result: %v", r)
 			}
@@ -268,18 +292,14 @@ func (h *Hystrix) GoC(ctx context.Context, runable func(context.Context) error)
 		// errchan first would let the caller observe the result (and inspect
 		// stats) while feedback is still running in this goroutine.
 		select {
-		case rc := <-resultChan:
-			h.feedback(rc)
-			errchan <- rc.err
-
+		case outcome = <-resultChan:
 		case <-ctx.Done():
-			h.feedback(snapshot{ErrCanceled, singletest, runStart, timex.UnixNano()})
-			errchan <- ErrCanceled
-
+			outcome = snapshot{ErrCanceled, singletest, runStart, timex.UnixNano()}
 		case <-tmoCtx.Done():
-			h.feedback(snapshot{ErrTimeout, singletest, runStart, timex.UnixNano()})
-			errchan <- ErrTimeout
+			outcome = snapshot{ErrTimeout, singletest, runStart, timex.UnixNano()}
 		}
+		h.feedback(outcome)
+		errchan <- outcome.err
 	}()
 
 	return errchan
@@ -289,7 +309,8 @@ func (h *Hystrix) GoC(ctx context.Context, runable func(context.Context) error)
 // If your function begins slowing down or failing repeatedly, we will block
 // new calls to it for you to give the dependent service time to repair.
 //
-// Define a fallback function if you want to define some code to execute during outages.
+// The name is informative only, the package level Go picks the circuit by name.
+// Use GoWithFallback if you want to define some code to execute during outages.
 func (h *Hystrix) Go(name string, runnable func() error) chan error {
 	return h.GoC(
 		context.TODO(),
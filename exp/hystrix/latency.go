@@ -0,0 +1,75 @@
+package hystrix
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	_LATENCY_WIN_SIZE = 1024 // recent latencies kept for the percentiles
+)
+
+// latencies keeps the latencies of the recent executions in a ring buffer,
+// along with the total of all the latencies ever added
+type latencies struct {
+	mu     sync.Mutex
+	buffer []time.Duration
+	pos    int
+	total  time.Duration // cumulative, never reset
+	count  int64         // cumulative, never reset
+}
+
+func newLatencies(capacity int) *latencies {
+	return &latencies{buffer: make([]time.Duration, 0, capacity)}
+}
+
+func (l *latencies) Add(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.total += d
+	l.count++
+	if len(l.buffer) < cap(l.buffer) {
+		l.buffer = append(l.buffer, d)
+		return
+	}
+	l.buffer[l.pos] = d
+	l.pos = (l.pos + 1) % len(l.buffer)
+}
+
+// Percentiles returns the latencies at the percentiles (0~100) and the mean of the recent latencies
+func (l *latencies) Percentiles(ps ...float64) ([]time.Duration, time.Duration) {
+	l.mu.Lock()
+	sorted := slices.Clone(l.buffer)
+	l.mu.Unlock()
+
+	res := make([]time.Duration, len(ps))
+	if len(sorted) == 0 {
+		return res, 0
+	}
+
+	slices.Sort(sorted)
+	var sum time.Duration
+	for _, d := range sorted {
+		sum += d
+	}
+	for i, p := range ps {
+		idx := int(p / 100 * float64(len(sorted)-1))
+		res[i] = sorted[min(max(idx, 0), len(sorted)-1)]
+	}
+	return res, sum / time.Duration(len(sorted))
+}
+
+// Total returns the sum and the count of all the latencies ever added
+func (l *latencies) Total() (time.Duration, int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.total, l.count
+}
+
+func (l *latencies) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buffer = l.buffer[:0]
+	l.pos = 0
+}
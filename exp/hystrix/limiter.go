@@ -0,0 +1,37 @@
+package hystrix
+
+import (
+	"time"
+)
+
+// Limiter controls the concurrency of the circuit, the default one is the Assigner sized by MaxConcurrency.
+// The adaptive limiters of exp/limiter fit in.
+type Limiter interface {
+	// TryAcquire takes a ticket unless the limit is reached
+	TryAcquire() bool
+	// Release returns the ticket, latency is how long the execution takes, dropped tells the execution is timeout
+	Release(latency time.Duration, dropped bool)
+	// Allocated returns the executions in flight
+	Allocated() int
+}
+
+// limiterBox keeps the limiter in an atomic pointer
+type limiterBox struct{ Limiter }
+
+// assignerLimiter adapts the Assigner to Limiter
+type assignerLimiter struct{ *Assigner }
+
+func (a assignerLimiter) Release(time.Duration, bool) { a.Assigner.Release() }
+
+// SetLimiter replaces the concurrency control of the circuit, MaxConcurrency takes no effect after that.
+// A nil limiter restores the Assigner.
+func (h *Hystrix) SetLimiter(l Limiter) {
+	if l == nil {
+		l = assignerLimiter{h.assigner}
+	}
+	h.limiter.Store(&limiterBox{l})
+}
+
+func (h *Hystrix) getLimiter() Limiter {
+	return h.limiter.Load().Limiter
+}
@@ -0,0 +1,47 @@
+package hystrix
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cocktail828/go-tools/exp/limiter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetLimiter(t *testing.T) {
+	h := NewHystrix(NewConfig())
+	h.Timeout.Update(20 * time.Millisecond)
+	h.MinQPSThreshold.Update(1000) // never trip
+
+	l := limiter.New(limiter.NewAIMD(limiter.AIMDConfig{Initial: 1}))
+	var mu sync.Mutex
+	var changes [][2]int
+	l.OnLimitChange(func(old, new int) {
+		mu.Lock()
+		defer mu.Unlock()
+		changes = append(changes, [2]int{old, new})
+	})
+	h.SetLimiter(l)
+
+	block := make(chan struct{})
+	ch := h.Go(t.Name(), func() error { <-block; return nil })
+	assert.Equal(t, ErrMaxConcurrency, h.Do(t.Name(), func() error { return nil }))
+	assert.Equal(t, 1, h.Statistic().Concurrency)
+	close(block)
+	assert.NoError(t, <-ch)
+	assert.Eventually(t, func() bool { return l.Allocated() == 0 }, time.Second, time.Millisecond)
+	assert.Eventually(t, func() bool { return l.Limit() == 2 }, time.Second, time.Millisecond)
+
+	// timeout is a drop
+	assert.Equal(t, ErrTimeout, h.Do(t.Name(), func() error { time.Sleep(50 * time.Millisecond); return nil }))
+	assert.Eventually(t, func() bool { return l.Limit() == 1 }, time.Second, time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, [][2]int{{1, 2}, {2, 1}}, changes)
+	mu.Unlock()
+
+	// back to the assigner
+	h.SetLimiter(nil)
+	assert.NoError(t, h.Do(t.Name(), func() error { return nil }))
+	assert.EqualValues(t, DefaultMaxConcurrency, h.assigner.Available())
+}
@@ -0,0 +1,309 @@
+package hystrix
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cocktail828/go-tools/z/timex"
+)
+
+// percentiles are the percentiles of the latency in the metrics
+var percentiles = []float64{0, 25, 50, 75, 90, 95, 99, 99.5, 100}
+
+// Metrics is a sample of a circuit, the counters are in the rolling window of 3s
+type Metrics struct {
+	Name string
+	Time time.Time
+	Statistic
+	Requests    int64           // executions, including the rejected ones
+	Errors      int64           // failed executions, including the rejected ones
+	Rejects     int64           // rejected by the circuit or the max concurrency
+	Timeouts    int64           // executions timeout
+	Percentiles []float64       // percentiles of Latency, 0~100
+	Latency     []time.Duration // latencies of the recent executions at Percentiles
+	LatencyMean time.Duration
+	LatencySum  time.Duration // sum of all the latencies since the circuit is created
+	LatencyNum  int64         // count of all the latencies since the circuit is created
+
+	circuit *Hystrix
+}
+
+func sample(name string, h *Hystrix) Metrics {
+	nsec := timex.UnixNano()
+	posi, _ := h.posiStat.At(nsec).Estimate(_COUNTER_WIN_SIZE)
+	nega, _ := h.negaStat.At(nsec).Estimate(_COUNTER_WIN_SIZE)
+	rejects, _ := h.rejectStat.At(nsec).Estimate(_COUNTER_WIN_SIZE)
+	timeouts, _ := h.timeoutStat.At(nsec).Estimate(_COUNTER_WIN_SIZE)
+	ps := slices.Clone(percentiles)
+	latency, mean := h.latencies.Percentiles(ps...)
+	sum, num := h.latencies.Total()
+
+	return Metrics{
+		Name:        name,
+		Time:        time.Unix(0, nsec),
+		Statistic:   h.Statistic(),
+		Requests:    posi + nega,
+		Errors:      nega,
+		Rejects:     rejects,
+		Timeouts:    timeouts,
+		Percentiles: ps,
+		Latency:     latency,
+		LatencyMean: mean,
+		LatencySum:  sum,
+		LatencyNum:  num,
+		circuit:     h,
+	}
+}
+
+// Collector samples the circuits of the named commands periodically
+type Collector struct {
+	mu      sync.RWMutex
+	metrics []Metrics
+	subs    map[chan []Metrics]struct{}
+	cancel  context.CancelFunc
+}
+
+// NewCollector starts sampling the circuits every interval, the collector must be closed after use.
+// A non-positive interval disables the periodical sampling, the metrics are sampled by Collect.
+func NewCollector(interval time.Duration) *Collector {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Collector{subs: map[chan []Metrics]struct{}{}, cancel: cancel}
+	if interval > 0 {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					c.Collect()
+				}
+			}
+		}()
+	}
+	return c
+}
+
+// Close stops the sampling
+func (c *Collector) Close() {
+	c.cancel()
+}
+
+// Collect samples every circuit now, the streams are notified
+func (c *Collector) Collect() []Metrics {
+	names := Circuits()
+	metrics := make([]Metrics, 0, len(names))
+	for _, name := range names {
+		metrics = append(metrics, sample(name, GetCircuit(name)))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.metrics = metrics
+	for ch := range c.subs {
+		// drop the sample if the stream is behind
+		select {
+		case ch <- metrics:
+		default:
+		}
+	}
+	return metrics
+}
+
+// Metrics returns the latest samples
+func (c *Collector) Metrics() []Metrics {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.metrics
+}
+
+func (c *Collector) subscribe() chan []Metrics {
+	ch := make(chan []Metrics, 1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subs[ch] = struct{}{}
+	return ch
+}
+
+func (c *Collector) unsubscribe(ch chan []Metrics) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.subs, ch)
+}
+
+// dashboardCommand is the HystrixCommand event of the hystrix dashboard
+type dashboardCommand struct {
+	Type                 string `json:"type"`
+	Name                 string `json:"name"`
+	Group                string `json:"group"`
+	CurrentTime          int64  `json:"currentTime"`
+	IsCircuitBreakerOpen bool   `json:"isCircuitBreakerOpen"`
+	ErrorPercentage      int    `json:"errorPercentage"`
+	ErrorCount           int64  `json:"errorCount"`
+	RequestCount         int64  `json:"requestCount"`
+
+	RollingCountFailure           int64 `json:"rollingCountFailure"`
+	RollingCountSuccess           int64 `json:"rollingCountSuccess"`
+	RollingCountShortCircuited    int64 `json:"rollingCountShortCircuited"`
+	RollingCountTimeout           int64 `json:"rollingCountTimeout"`
+	RollingCountSemaphoreRejected int64 `json:"rollingCountSemaphoreRejected"`
+
+	CurrentConcurrentExecutionCount int              `json:"currentConcurrentExecutionCount"`
+	LatencyExecute                  map[string]int64 `json:"latencyExecute"`
+	LatencyExecuteMean              int64            `json:"latencyExecute_mean"`
+	LatencyTotal                    map[string]int64 `json:"latencyTotal"`
+	LatencyTotalMean                int64            `json:"latencyTotal_mean"`
+
+	CircuitBreakerRequestVolumeThreshold int   `json:"propertyValue_circuitBreakerRequestVolumeThreshold"`
+	CircuitBreakerSleepWindow            int64 `json:"propertyValue_circuitBreakerSleepWindowInMilliseconds"`
+	CircuitBreakerErrorThreshold         int   `json:"propertyValue_circuitBreakerErrorThresholdPercentage"`
+	CircuitBreakerForceOpen              bool  `json:"propertyValue_circuitBreakerForceOpen"`
+	ExecutionTimeout                     int64 `json:"propertyValue_executionIsolationThreadTimeoutInMilliseconds"`
+	ExecutionMaxConcurrentRequests       int   `json:"propertyValue_executionIsolationSemaphoreMaxConcurrentRequests"`
+	ReportingHosts                       int   `json:"reportingHosts"`
+}
+
+func (m Metrics) dashboard() dashboardCommand {
+	latency := make(map[string]int64, len(m.Percentiles))
+	for i, p := range m.Percentiles {
+		latency[strconv.FormatFloat(p, 'f', -1, 64)] = m.Latency[i].Milliseconds()
+	}
+
+	h := m.circuit
+	return dashboardCommand{
+		Type:                 "HystrixCommand",
+		Name:                 m.Name,
+		Group:                m.Name,
+		CurrentTime:          m.Time.UnixMilli(),
+		IsCircuitBreakerOpen: m.IsOpen || h.isForceOpen.Load(),
+		ErrorPercentage:      int(m.FailRate),
+		ErrorCount:           m.Errors,
+		RequestCount:         m.Requests,
+
+		RollingCountFailure:           m.Errors - m.Rejects - m.Timeouts,
+		RollingCountSuccess:           m.Requests - m.Errors,
+		RollingCountShortCircuited:    m.Rejects,
+		RollingCountTimeout:           m.Timeouts,
+		RollingCountSemaphoreRejected: 0, // counted as short circuited
+
+		CurrentConcurrentExecutionCount: m.Concurrency,
+		LatencyExecute:                  latency,
+		LatencyExecuteMean:              m.LatencyMean.Milliseconds(),
+		LatencyTotal:                    latency,
+		LatencyTotalMean:                m.LatencyMean.Milliseconds(),
+
+		CircuitBreakerRequestVolumeThreshold: h.MinQPSThreshold.Val.Get(),
+		CircuitBreakerSleepWindow:            h.KeepAliveInterval.Val.Get().Milliseconds(),
+		CircuitBreakerErrorThreshold:         h.FailureThreshold.Val.Get(),
+		CircuitBreakerForceOpen:              h.isForceOpen.Load(),
+		ExecutionTimeout:                     h.Timeout.Val.Get().Milliseconds(),
+		ExecutionMaxConcurrentRequests:       h.MaxConcurrency.Val.Get(),
+		ReportingHosts:                       1,
+	}
+}
+
+// StreamHandler serves the samples as a server-sent events stream compatible with the hystrix dashboard,
+// every circuit is an event of type HystrixCommand.
+func (c *Collector) StreamHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		ch := c.subscribe()
+		defer c.unsubscribe(ch)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		metrics := c.Metrics()
+		for {
+			for _, m := range metrics {
+				data, err := json.Marshal(m.dashboard())
+				if err != nil {
+					continue
+				}
+				if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+					return
+				}
+			}
+			flusher.Flush()
+
+			select {
+			case <-r.Context().Done():
+				return
+			case metrics = <-ch:
+			}
+		}
+	})
+}
+
+// PrometheusHandler serves the latest samples in the prometheus text format
+func (c *Collector) PrometheusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writePrometheus(w, c.Metrics())
+	})
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func writePrometheus(w io.Writer, metrics []Metrics) {
+	gauge := func(name, help string, value func(Metrics) float64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+		for _, m := range metrics {
+			fmt.Fprintf(w, "%s{circuit=\"%s\"} %s\n", name, labelEscaper.Replace(m.Name), formatFloat(value(m)))
+		}
+	}
+
+	gauge("hystrix_concurrency", "Executions of the circuit in flight.",
+		func(m Metrics) float64 { return float64(m.Concurrency) })
+	gauge("hystrix_fail_rate", "Percentage of the failed executions in the rolling window.",
+		func(m Metrics) float64 { return m.FailRate })
+	gauge("hystrix_slow_rate", "Percentage of the slow executions in the rolling window.",
+		func(m Metrics) float64 { return m.SlowRate })
+	gauge("hystrix_qps", "Executions per second in the rolling window.",
+		func(m Metrics) float64 { return m.QPS })
+	gauge("hystrix_requests", "Executions in the rolling window.",
+		func(m Metrics) float64 { return float64(m.Requests) })
+	gauge("hystrix_errors", "Failed executions in the rolling window.",
+		func(m Metrics) float64 { return float64(m.Errors) })
+	gauge("hystrix_rejects", "Executions rejected by the circuit or the max concurrency in the rolling window.",
+		func(m Metrics) float64 { return float64(m.Rejects) })
+	gauge("hystrix_timeouts", "Executions timeout in the rolling window.",
+		func(m Metrics) float64 { return float64(m.Timeouts) })
+	gauge("hystrix_state", "State of the circuit: 0 closed, 1 open, 2 half-open.",
+		func(m Metrics) float64 { return float64(m.State) })
+	gauge("hystrix_state_duration_seconds", "Time since the last state change of the circuit.",
+		func(m Metrics) float64 { return m.StateDuration / 1000 })
+
+	const name = "hystrix_latency_seconds"
+	fmt.Fprintf(w, "# HELP %s Latency of the executions, the quantiles are of the recent ones.\n# TYPE %s summary\n", name, name)
+	for _, m := range metrics {
+		circuit := labelEscaper.Replace(m.Name)
+		for i, p := range m.Percentiles {
+			fmt.Fprintf(w, "%s{circuit=\"%s\",quantile=\"%s\"} %s\n", name, circuit,
+				formatFloat(p/100), formatFloat(m.Latency[i].Seconds()))
+		}
+		fmt.Fprintf(w, "%s_sum{circuit=\"%s\"} %s\n", name, circuit, formatFloat(m.LatencySum.Seconds()))
+		fmt.Fprintf(w, "%s_count{circuit=\"%s\"} %d\n", name, circuit, m.LatencyNum)
+	}
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,124 @@
+package hystrix
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cocktail828/go-tools/z"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatencies(t *testing.T) {
+	l := newLatencies(4)
+	ps, mean := l.Percentiles(50)
+	assert.Equal(t, []time.Duration{0}, ps)
+	assert.Zero(t, mean)
+	sum, n := l.Total()
+	assert.Zero(t, sum)
+	assert.Zero(t, n)
+
+	for i := range 6 {
+		l.Add(time.Duration(i+1) * time.Millisecond)
+	}
+	// 3, 4, 5, 6 are kept
+	ps, mean = l.Percentiles(0, 50, 100)
+	assert.Equal(t, []time.Duration{3 * time.Millisecond, 4 * time.Millisecond, 6 * time.Millisecond}, ps)
+	assert.Equal(t, 4500*time.Microsecond, mean)
+	// the total covers the latencies out of the window as well
+	sum, n = l.Total()
+	assert.Equal(t, 21*time.Millisecond, sum)
+	assert.EqualValues(t, 6, n)
+
+	l.Reset()
+	sum, n = l.Total()
+	assert.Equal(t, 21*time.Millisecond, sum)
+	assert.EqualValues(t, 6, n)
+}
+
+func runCommands(t *testing.T) {
+	assert.NoError(t, Do("ok", func() error { time.Sleep(time.Millisecond); return nil }))
+	assert.Equal(t, net.ErrClosed, Do("ok", func() error { return net.ErrClosed }))
+	GetCircuit(`b"ad`).Trigger(true)
+	assert.Equal(t, ErrCircuitOpen, Do(`b"ad`, func() error { return nil }))
+}
+
+func TestPrometheusHandler(t *testing.T) {
+	defer Flush()
+	runCommands(t)
+
+	c := NewCollector(0)
+	defer c.Close()
+	assert.Len(t, c.Collect(), 2)
+
+	rec := httptest.NewRecorder()
+	c.PrometheusHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	assert.Contains(t, body, "# TYPE hystrix_fail_rate gauge\n")
+	assert.Contains(t, body, `hystrix_fail_rate{circuit="ok"} 50`+"\n")
+	assert.Contains(t, body, `hystrix_requests{circuit="ok"} 2`+"\n")
+	assert.Contains(t, body, `hystrix_rejects{circuit="b\"ad"} 1`+"\n")
+	assert.Contains(t, body, `hystrix_state{circuit="ok"} 0`+"\n")
+	assert.Contains(t, body, "# TYPE hystrix_latency_seconds summary\n")
+	assert.Contains(t, body, `hystrix_latency_seconds{circuit="ok",quantile="0.5"} `)
+	assert.Contains(t, body, `hystrix_latency_seconds_count{circuit="ok"} 2`+"\n")
+	assert.Contains(t, body, `hystrix_latency_seconds_sum{circuit="ok"} `)
+
+	// the metrics own their percentiles
+	m := c.Metrics()[0]
+	m.Percentiles[0] = 42
+	assert.Equal(t, 0.0, c.Collect()[0].Percentiles[0])
+	assert.Len(t, m.Latency, len(m.Percentiles))
+}
+
+func TestStreamHandler(t *testing.T) {
+	defer Flush()
+	runCommands(t)
+
+	c := NewCollector(10 * time.Millisecond)
+	defer c.Close()
+	srv := httptest.NewServer(c.StreamHandler())
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	z.Must(err)
+	resp, err := http.DefaultClient.Do(req)
+	z.Must(err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	events := map[string]dashboardCommand{}
+	r := bufio.NewReader(resp.Body)
+	for len(events) < 2 {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		z.Must(err)
+		data, ok := strings.CutPrefix(strings.TrimSpace(line), "data: ")
+		if !ok {
+			continue
+		}
+		var cmd dashboardCommand
+		z.Must(json.Unmarshal([]byte(data), &cmd))
+		events[cmd.Name] = cmd
+	}
+
+	assert.Equal(t, "HystrixCommand", events["ok"].Type)
+	assert.EqualValues(t, 2, events["ok"].RequestCount)
+	assert.EqualValues(t, 1, events["ok"].ErrorCount)
+	assert.Equal(t, 50, events["ok"].ErrorPercentage)
+	assert.Contains(t, events["ok"].LatencyExecute, "99.5")
+	assert.True(t, events[`b"ad`].IsCircuitBreakerOpen)
+	assert.EqualValues(t, 1, events[`b"ad`].RollingCountShortCircuited)
+}
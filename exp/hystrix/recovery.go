@@ -86,6 +86,13 @@ func (r *recovery) IsHealthy() bool {
 	return successRate >= 0.8
 }
 
+// Full tells whether the buffer is full of probe results
+func (r *recovery) Full() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.size == r.capacity
+}
+
 // Reset reset the recovery status to the initial state.
 func (r *recovery) Reset() {
 	r.mu.Lock()
@@ -0,0 +1,97 @@
+package hystrix
+
+import (
+	"github.com/cocktail828/go-tools/z/timex"
+)
+
+// State is the state of the circuitbreaker
+type State int32
+
+const (
+	StateClosed   State = iota // requests pass, the statistics are checked
+	StateOpen                  // requests are rejected until KeepAliveInterval elapses
+	StateHalfOpen              // HalfOpenCalls requests probe the recovery at the same time
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// OnStateChange registers the listener called on every state transition of the circuitbreaker.
+// The listener is called synchronously, it should not block.
+func (h *Hystrix) OnStateChange(f func(from, to State)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.listeners = append(h.listeners, f)
+}
+
+// State returns the current state of the circuitbreaker
+func (h *Hystrix) State() State {
+	return State(h.state.Load())
+}
+
+// transit moves the circuitbreaker from one state to another, it returns false if the circuitbreaker is not in from
+func (h *Hystrix) transit(from, to State) bool {
+	if !h.state.CompareAndSwap(int32(from), int32(to)) {
+		return false
+	}
+
+	now := timex.UnixNano()
+	h.stateChangeAt.Store(now)
+	switch to {
+	case StateOpen:
+		h.logger.Printf("hystrix-go: opening circuitbreaker from %s. Stats: %s", from, h.Statistic())
+		// Don't reset immediately - let old data expire naturally
+		// This prevents race with concurrent feedback() calls
+	case StateHalfOpen:
+		h.halfOpenCalls.Store(0)
+		h.recovery.Reset()
+		h.logger.Printf("hystrix-go: half-opening circuitbreaker, allowing %d test requests.", h.HalfOpenCalls.Val.Get())
+	case StateClosed:
+		h.logger.Printf("hystrix-go: closing circuitbreaker. Recovery status: %s", h.recovery)
+		h.recovery.Reset()
+		h.posiStat.Reset() // Safe to reset here after circuit closes
+		h.negaStat.Reset()
+		h.slowStat.Reset()
+	}
+
+	h.mu.RLock()
+	listeners := h.listeners
+	h.mu.RUnlock()
+	for _, f := range listeners {
+		f(from, to)
+	}
+	return true
+}
+
+// acquireHalfOpen takes a permit of the half-open calls
+func (h *Hystrix) acquireHalfOpen() bool {
+	for {
+		n := h.halfOpenCalls.Load()
+		if int(n) >= h.HalfOpenCalls.Val.Get() {
+			return false
+		}
+		if h.halfOpenCalls.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// releaseHalfOpen returns a permit of the half-open calls
+func (h *Hystrix) releaseHalfOpen() {
+	for {
+		n := h.halfOpenCalls.Load()
+		if n <= 0 || h.halfOpenCalls.CompareAndSwap(n, n-1) {
+			return
+		}
+	}
+}
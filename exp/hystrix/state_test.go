@@ -0,0 +1,116 @@
+package hystrix
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cocktail828/go-tools/z/timex"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateString(t *testing.T) {
+	assert.Equal(t, "closed", StateClosed.String())
+	assert.Equal(t, "open", StateOpen.String())
+	assert.Equal(t, "half-open", StateHalfOpen.String())
+}
+
+func TestStateMachine(t *testing.T) {
+	var now atomic.Int64
+	timex.SetTime(now.Load)
+	defer timex.ResetTime()
+
+	cfg := NewConfig()
+	cfg.MinQPSThreshold.Update(0)
+	cfg.KeepAliveProbes.Update(3)
+	cfg.HalfOpenCalls.Update(2)
+	h := NewHystrix(cfg)
+
+	var mu sync.Mutex
+	var transitions [][2]State
+	h.OnStateChange(func(from, to State) {
+		mu.Lock()
+		defer mu.Unlock()
+		transitions = append(transitions, [2]State{from, to})
+	})
+
+	fail := func(context.Context) error { return net.ErrClosed }
+	pass := func(context.Context) error { return nil }
+	assert.Equal(t, net.ErrClosed, h.DoC(context.Background(), t.Name(), fail))
+	assert.Equal(t, ErrCircuitOpen, h.DoC(context.Background(), t.Name(), pass))
+	assert.Equal(t, StateOpen, h.State())
+	assert.True(t, h.Statistic().IsOpen)
+
+	// half-open after KeepAliveInterval, only HalfOpenCalls test requests run at the same time
+	now.Add(h.KeepAliveInterval.Val.Get().Nanoseconds())
+	block := make(chan struct{})
+	running := func(ctx context.Context) error {
+		assert.Equal(t, true, ctx.Value(singleTestMeta{}))
+		<-block
+		return nil
+	}
+	ch0 := h.GoC(context.Background(), running)
+	ch1 := h.GoC(context.Background(), running)
+	assert.Equal(t, ErrCircuitOpen, h.DoC(context.Background(), t.Name(), pass))
+	assert.Equal(t, StateHalfOpen, h.State())
+	close(block)
+	assert.NoError(t, <-ch0)
+	assert.NoError(t, <-ch1)
+
+	// the recovery fails, open again
+	assert.Equal(t, net.ErrClosed, h.DoC(context.Background(), t.Name(), fail))
+	assert.Equal(t, StateOpen, h.State())
+
+	// all the test requests succeed, closed
+	now.Add(h.KeepAliveInterval.Val.Get().Nanoseconds())
+	for range 3 {
+		assert.NoError(t, h.DoC(context.Background(), t.Name(), pass))
+	}
+	assert.Equal(t, StateClosed, h.State())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, [][2]State{
+		{StateClosed, StateOpen},
+		{StateOpen, StateHalfOpen},
+		{StateHalfOpen, StateOpen},
+		{StateOpen, StateHalfOpen},
+		{StateHalfOpen, StateClosed},
+	}, transitions)
+}
+
+func TestSlowCall(t *testing.T) {
+	var now atomic.Int64
+	timex.SetTime(now.Load)
+	defer timex.ResetTime()
+
+	cfg := NewConfig()
+	cfg.MinQPSThreshold.Update(0)
+	cfg.FailureThreshold.Update(100)
+	cfg.SlowCallDuration.Update(100 * time.Millisecond)
+	cfg.SlowCallThreshold.Update(50)
+	h := NewHystrix(cfg)
+
+	fast := func(context.Context) error { now.Add(int64(10 * time.Millisecond)); return nil }
+	slow := func(context.Context) error { now.Add(int64(200 * time.Millisecond)); return nil }
+	assert.NoError(t, h.DoC(context.Background(), t.Name(), fast))
+	assert.NoError(t, h.DoC(context.Background(), t.Name(), fast))
+	assert.NoError(t, h.DoC(context.Background(), t.Name(), slow))
+	assert.InDelta(t, 33.3, h.Statistic().SlowRate, 0.1)
+	assert.NoError(t, h.DoC(context.Background(), t.Name(), fast), "slow rate below the threshold")
+
+	assert.NoError(t, h.DoC(context.Background(), t.Name(), slow))
+	assert.NoError(t, h.DoC(context.Background(), t.Name(), slow))
+	assert.Equal(t, ErrCircuitOpen, h.DoC(context.Background(), t.Name(), fast))
+	assert.Equal(t, StateOpen, h.State())
+
+	// a slow test request fails the recovery
+	now.Add(h.KeepAliveInterval.Val.Get().Nanoseconds())
+	for range h.KeepAliveProbes.Val.Get() {
+		assert.NoError(t, h.DoC(context.Background(), t.Name(), slow))
+	}
+	assert.Equal(t, StateOpen, h.State())
+}
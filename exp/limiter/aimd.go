@@ -0,0 +1,50 @@
+package limiter
+
+import (
+	"time"
+)
+
+// AIMDConfig configures the AIMD algorithm, the zero values take the defaults
+type AIMDConfig struct {
+	Initial int           // initial limit, default 20
+	Min     int           // min limit, default 1
+	Max     int           // max limit, default 200
+	Backoff float64       // the limit is multiplied by it on drops, in (0, 1), default 0.9
+	Timeout time.Duration // an execution slower than it counts as a drop, 0 means never
+}
+
+type aimd struct {
+	AIMDConfig
+	limit float64
+}
+
+// NewAIMD is the additive increase multiplicative decrease algorithm,
+// the limit grows by 1 while the executions are fine and backs off on drops.
+func NewAIMD(cfg AIMDConfig) Algorithm {
+	if cfg.Initial <= 0 {
+		cfg.Initial = 20
+	}
+	if cfg.Min <= 0 {
+		cfg.Min = 1
+	}
+	if cfg.Max <= 0 {
+		cfg.Max = 200
+	}
+	if cfg.Backoff <= 0 || cfg.Backoff >= 1 {
+		cfg.Backoff = 0.9
+	}
+	return &aimd{AIMDConfig: cfg, limit: clamp(float64(cfg.Initial), cfg.Min, cfg.Max)}
+}
+
+func (a *aimd) Limit() int { return int(a.limit) }
+
+func (a *aimd) Update(rtt time.Duration, inflight int, dropped bool) int {
+	switch {
+	case dropped || a.Timeout > 0 && rtt > a.Timeout:
+		a.limit = clamp(a.limit*a.Backoff, a.Min, a.Max)
+	case inflight*2 >= int(a.limit):
+		// grow only if the limit is in use
+		a.limit = clamp(a.limit+1, a.Min, a.Max)
+	}
+	return int(a.limit)
+}
@@ -0,0 +1,82 @@
+package limiter
+
+import (
+	"math"
+	"time"
+)
+
+// GradientConfig configures the gradient algorithm, the zero values take the defaults
+type GradientConfig struct {
+	Initial      int     // initial limit, default 20
+	Min          int     // min limit, default 1
+	Max          int     // max limit, default 200
+	Smoothing    float64 // weight of the new limit, in (0, 1], default 0.2
+	RTTTolerance float64 // how much the latency may exceed the long term latency before the limit shrinks, default 1.5
+	LongWindow   int     // samples of the long term latency, default 600
+}
+
+type gradient struct {
+	GradientConfig
+	limit   float64
+	longRTT float64 // exponential moving average of the latency
+}
+
+// NewGradient is the gradient algorithm, the limit follows the ratio of the long term latency
+// to the latest latency, plus sqrt(limit) of queue for bursts.
+// A drop halves the gradient.
+func NewGradient(cfg GradientConfig) Algorithm {
+	if cfg.Initial <= 0 {
+		cfg.Initial = 20
+	}
+	if cfg.Min <= 0 {
+		cfg.Min = 1
+	}
+	if cfg.Max <= 0 {
+		cfg.Max = 200
+	}
+	if cfg.Smoothing <= 0 || cfg.Smoothing > 1 {
+		cfg.Smoothing = 0.2
+	}
+	if cfg.RTTTolerance < 1 {
+		cfg.RTTTolerance = 1.5
+	}
+	if cfg.LongWindow <= 0 {
+		cfg.LongWindow = 600
+	}
+	return &gradient{GradientConfig: cfg, limit: clamp(float64(cfg.Initial), cfg.Min, cfg.Max)}
+}
+
+func (g *gradient) Limit() int { return int(g.limit) }
+
+func (g *gradient) Update(rtt time.Duration, inflight int, dropped bool) int {
+	if rtt <= 0 {
+		return int(g.limit)
+	}
+
+	short := float64(rtt)
+	if g.longRTT == 0 {
+		g.longRTT = short
+	} else {
+		factor := 2 / float64(g.LongWindow+1)
+		g.longRTT = g.longRTT*(1-factor) + short*factor
+	}
+	// the long term latency catches up quickly once the latency drops
+	if g.longRTT/short > 2 {
+		g.longRTT *= 0.95
+	}
+
+	var grad float64
+	switch {
+	case dropped:
+		grad = 0.5
+	case float64(inflight)*2 < g.limit:
+		// the limit is not in use, nothing learned
+		return int(g.limit)
+	default:
+		grad = max(0.5, min(1, g.RTTTolerance*g.longRTT/short))
+	}
+
+	limit := g.limit*grad + math.Sqrt(g.limit)
+	g.limit = clamp((1-g.Smoothing)*g.limit+g.Smoothing*limit, g.Min, g.Max)
+	return int(g.limit)
+}
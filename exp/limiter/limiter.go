@@ -0,0 +1,91 @@
+// Package limiter is the adaptive concurrency limiter, the limit follows the latency and the drops
+// observed on the executions, see https://github.com/Netflix/concurrency-limits
+package limiter
+
+import (
+	"sync"
+	"time"
+)
+
+// Algorithm tells the concurrency limit from the samples of the executions
+type Algorithm interface {
+	// Limit returns the current limit
+	Limit() int
+	// Update feeds a sample and returns the new limit.
+	// rtt is the latency of the execution, inflight is the executions in flight when it finishes,
+	// dropped tells the execution is timeout or rejected by the downstream.
+	Update(rtt time.Duration, inflight int, dropped bool) int
+}
+
+// clamp keeps the limit in [min, max]
+func clamp(limit float64, lo, hi int) float64 {
+	return min(max(limit, float64(lo)), float64(hi))
+}
+
+// Limiter limits the executions in flight by the limit of the algorithm
+type Limiter struct {
+	mu        sync.Mutex
+	algo      Algorithm
+	inflight  int
+	limit     int
+	listeners []func(old, new int)
+}
+
+// New creates a limiter adjusted by the algorithm
+func New(algo Algorithm) *Limiter {
+	return &Limiter{algo: algo, limit: algo.Limit()}
+}
+
+// OnLimitChange registers the listener called on every change of the limit.
+// The listener is called synchronously, it should not block.
+func (l *Limiter) OnLimitChange(f func(old, new int)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.listeners = append(l.listeners, f)
+}
+
+// TryAcquire takes a ticket unless the limit is reached
+func (l *Limiter) TryAcquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inflight >= l.limit {
+		return false
+	}
+	l.inflight++
+	return true
+}
+
+// Release returns the ticket and feeds the sample to the algorithm.
+// latency is how long the execution takes, dropped tells the execution is timeout or rejected by the downstream.
+func (l *Limiter) Release(latency time.Duration, dropped bool) {
+	l.mu.Lock()
+	inflight := l.inflight
+	if l.inflight > 0 {
+		l.inflight--
+	}
+	old := l.limit
+	l.limit = l.algo.Update(latency, inflight, dropped)
+	curr := l.limit
+	listeners := l.listeners
+	l.mu.Unlock()
+
+	if old != curr {
+		for _, f := range listeners {
+			f(old, curr)
+		}
+	}
+}
+
+// Allocated returns the executions in flight
+func (l *Limiter) Allocated() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inflight
+}
+
+// Limit returns the current limit
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
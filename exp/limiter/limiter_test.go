@@ -0,0 +1,92 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	l := New(NewAIMD(AIMDConfig{Initial: 2, Max: 3}))
+	assert.True(t, l.TryAcquire())
+	assert.True(t, l.TryAcquire())
+	assert.False(t, l.TryAcquire())
+	assert.Equal(t, 2, l.Allocated())
+
+	var changes [][2]int
+	l.OnLimitChange(func(old, new int) { changes = append(changes, [2]int{old, new}) })
+
+	// the limit is in use, it grows
+	l.Release(time.Millisecond, false)
+	assert.Equal(t, 3, l.Limit())
+	assert.True(t, l.TryAcquire())
+	assert.True(t, l.TryAcquire())
+	assert.False(t, l.TryAcquire())
+
+	// drops back off
+	l.Release(time.Millisecond, true)
+	l.Release(time.Millisecond, true)
+	l.Release(time.Millisecond, true)
+	assert.Equal(t, 0, l.Allocated())
+	assert.Equal(t, 2, l.Limit())
+	assert.Equal(t, [][2]int{{2, 3}, {3, 2}}, changes)
+}
+
+func TestAIMD(t *testing.T) {
+	a := NewAIMD(AIMDConfig{Initial: 10, Timeout: 100 * time.Millisecond})
+	assert.Equal(t, 10, a.Update(time.Millisecond, 1, false), "not in use")
+	assert.Equal(t, 11, a.Update(time.Millisecond, 5, false))
+	assert.Equal(t, 9, a.Update(time.Second, 5, false), "slower than timeout")
+	for range 100 {
+		a.Update(time.Millisecond, 0, true)
+	}
+	assert.Equal(t, 1, a.Limit())
+}
+
+// converge feeds the samples of a server whose latency grows with the concurrency beyond its capacity
+func converge(a Algorithm, capacity int) int {
+	for range 2000 {
+		inflight := a.Limit()
+		rtt := 10 * time.Millisecond
+		if inflight > capacity {
+			rtt = rtt * time.Duration(inflight) / time.Duration(capacity)
+		}
+		a.Update(rtt, inflight, false)
+	}
+	return a.Limit()
+}
+
+func TestVegas(t *testing.T) {
+	v := NewVegas(VegasConfig{Initial: 10})
+	assert.Equal(t, 10, v.Update(10*time.Millisecond, 1, false), "not in use")
+	assert.Greater(t, v.Update(10*time.Millisecond, 10, false), 10, "no queue, it grows")
+	assert.Less(t, v.Update(10*time.Millisecond, 10, true), v.Limit()+1, "drops shrink")
+
+	assert.InDelta(t, 50, converge(NewVegas(VegasConfig{Initial: 10}), 50), 10)
+}
+
+func TestGradient(t *testing.T) {
+	g := NewGradient(GradientConfig{Initial: 10})
+	assert.Equal(t, 10, g.Update(10*time.Millisecond, 1, false), "not in use")
+	for range 10 {
+		g.Update(10*time.Millisecond, g.Limit(), false)
+	}
+	assert.Greater(t, g.Limit(), 15, "steady latency, it grows")
+
+	prev := g.Limit()
+	for range 5 {
+		g.Update(10*time.Millisecond, g.Limit(), true)
+	}
+	assert.Less(t, g.Limit(), prev, "drops shrink")
+
+	// the latency jumps over the tolerance of the long term latency
+	for range 100 {
+		g.Update(10*time.Millisecond, g.Limit(), false)
+	}
+	prev = g.Limit()
+	for range 10 {
+		g.Update(50*time.Millisecond, g.Limit(), false)
+	}
+	assert.Less(t, g.Limit(), prev/2)
+}
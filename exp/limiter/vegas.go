@@ -0,0 +1,76 @@
+package limiter
+
+import (
+	"math"
+	"time"
+)
+
+// VegasConfig configures the Vegas algorithm, the zero values take the defaults
+type VegasConfig struct {
+	Initial   int     // initial limit, default 20
+	Min       int     // min limit, default 1
+	Max       int     // max limit, default 1000
+	Smoothing float64 // weight of the new limit, in (0, 1], default 1
+}
+
+type vegas struct {
+	VegasConfig
+	limit     float64
+	rttNoLoad time.Duration
+}
+
+// NewVegas is the delay based algorithm of TCP Vegas, the queue is estimated by
+// limit * (1 - rttNoLoad/rtt) where rttNoLoad is the min latency observed.
+// The limit grows while the queue is short and shrinks once it is long, both by log10(limit).
+func NewVegas(cfg VegasConfig) Algorithm {
+	if cfg.Initial <= 0 {
+		cfg.Initial = 20
+	}
+	if cfg.Min <= 0 {
+		cfg.Min = 1
+	}
+	if cfg.Max <= 0 {
+		cfg.Max = 1000
+	}
+	if cfg.Smoothing <= 0 || cfg.Smoothing > 1 {
+		cfg.Smoothing = 1
+	}
+	return &vegas{VegasConfig: cfg, limit: clamp(float64(cfg.Initial), cfg.Min, cfg.Max)}
+}
+
+func (v *vegas) Limit() int { return int(v.limit) }
+
+func (v *vegas) Update(rtt time.Duration, inflight int, dropped bool) int {
+	if rtt <= 0 {
+		return int(v.limit)
+	}
+	if v.rttNoLoad == 0 || rtt < v.rttNoLoad {
+		v.rttNoLoad = rtt
+	}
+
+	step := max(1, math.Log10(v.limit))
+	var limit float64
+	switch {
+	case dropped:
+		limit = v.limit - step
+	case float64(inflight)*2 < v.limit:
+		// the limit is not in use, nothing learned
+		return int(v.limit)
+	default:
+		queue := math.Ceil(v.limit * (1 - float64(v.rttNoLoad)/float64(rtt)))
+		alpha, beta := 3*step, 6*step
+		switch {
+		case queue <= step:
+			limit = v.limit + beta
+		case queue < alpha:
+			limit = v.limit + step
+		case queue > beta:
+			limit = v.limit - step
+		default:
+			return int(v.limit)
+		}
+	}
+
+	v.limit = clamp((1-v.Smoothing)*v.limit+v.Smoothing*limit, v.Min, v.Max)
+	return int(v.limit)
+}
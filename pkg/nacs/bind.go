@@ -0,0 +1,156 @@
+package nacs
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/BurntSushi/toml"
+	"github.com/cocktail828/go-tools/configor"
+	"github.com/cocktail828/go-tools/configor/hcl2"
+	"github.com/go-playground/validator/v10"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is the encoding of the config payload
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatTOML Format = "toml"
+	FormatYAML Format = "yaml"
+	FormatHCL  Format = "hcl"
+)
+
+// Unmarshaller returns the decoder of the format
+func (f Format) Unmarshaller() (func([]byte, any) error, error) {
+	switch f {
+	case FormatJSON:
+		return json.Unmarshal, nil
+	case FormatTOML:
+		return toml.Unmarshal, nil
+	case FormatYAML:
+		return yaml.Unmarshal, nil
+	case FormatHCL:
+		return hcl2.Unmarshal, nil
+	default:
+		return nil, errors.Errorf("nacs: unsupported config format %q", f)
+	}
+}
+
+type bindOption struct {
+	loader  *configor.Configor
+	onError func(ConfigInfo, error)
+}
+
+type BindOption func(*bindOption)
+
+// WithLoader sets the configor which applies defaults, env overrides and validation,
+// its Unmarshaller is replaced by the one of the format.
+func WithLoader(loader *configor.Configor) BindOption {
+	return func(o *bindOption) { o.loader = loader }
+}
+
+// WithErrorHandler sets the handler of the payloads which fail to load or decode
+func WithErrorHandler(f func(ConfigInfo, error)) BindOption {
+	return func(o *bindOption) { o.onError = f }
+}
+
+// Binding keeps the latest valid config decoded from a Configor
+type Binding[T any] struct {
+	opt     *bindOption
+	cancel  context.CancelFunc
+	current atomic.Pointer[T]
+
+	mu        sync.Mutex
+	listeners []func(prev, curr T)
+}
+
+// Bind loads the config of c and decodes it as format into T, which must be a struct.
+// It fails if the initial config is invalid, later invalid payloads are reported to the
+// error handler and the last good value is kept.
+// The configor is not closed by the binding.
+func Bind[T any](c Configor, format Format, opts ...BindOption) (*Binding[T], error) {
+	unmarshal, err := format.Unmarshaller()
+	if err != nil {
+		return nil, err
+	}
+
+	o := &bindOption{
+		loader:  &configor.Configor{Validator: validator.New().Struct},
+		onError: func(ConfigInfo, error) {},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	loader := *o.loader
+	loader.Unmarshaller = unmarshal
+	o.loader = &loader
+
+	b := &Binding[T]{opt: o}
+	info, err := c.Load(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	val, err := b.decode(info)
+	if err != nil {
+		return nil, err
+	}
+	b.current.Store(val)
+
+	cancel, err := c.Monitor(b.update)
+	if err != nil {
+		return nil, err
+	}
+	b.cancel = cancel
+	return b, nil
+}
+
+func (b *Binding[T]) decode(info ConfigInfo) (*T, error) {
+	val := new(T)
+	if err := b.opt.loader.Load(val, info.Payload); err != nil {
+		return nil, errors.Wrapf(err, "nacs: decode config %s fail", info.DataID)
+	}
+	return val, nil
+}
+
+func (b *Binding[T]) update(info ConfigInfo, err error) {
+	if err == nil {
+		var val *T
+		if val, err = b.decode(info); err == nil {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			// formatting and comments are not a change
+			prev := b.current.Load()
+			if reflect.DeepEqual(prev, val) {
+				return
+			}
+			b.current.Store(val)
+			for _, f := range b.listeners {
+				f(*prev, *val)
+			}
+			return
+		}
+	}
+	b.opt.onError(info, err)
+}
+
+// Get returns the current config
+func (b *Binding[T]) Get() T { return *b.current.Load() }
+
+// OnChange registers a listener which is invoked with the previous and the current config on every change
+func (b *Binding[T]) OnChange(f func(prev, curr T)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.listeners = append(b.listeners, f)
+}
+
+// Close stops monitoring the configor
+func (b *Binding[T]) Close() error {
+	b.cancel()
+	return nil
+}
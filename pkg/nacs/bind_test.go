@@ -0,0 +1,98 @@
+package nacs_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cocktail828/go-tools/configor"
+	"github.com/cocktail828/go-tools/pkg/nacs"
+	"github.com/cocktail828/go-tools/z"
+	"github.com/stretchr/testify/assert"
+)
+
+// pushConfigor delivers the payloads pushed by the test
+type pushConfigor struct {
+	payload []byte
+	cb      func(nacs.ConfigInfo, error)
+}
+
+func (c *pushConfigor) Load(ctx context.Context) (nacs.ConfigInfo, error) {
+	return nacs.ConfigInfo{DataID: "test", Payload: c.payload}, nil
+}
+
+func (c *pushConfigor) Monitor(cb func(nacs.ConfigInfo, error)) (context.CancelFunc, error) {
+	c.cb = cb
+	return func() { c.cb = nil }, nil
+}
+
+func (c *pushConfigor) Close() error { return nil }
+
+func (c *pushConfigor) push(payload string) {
+	c.cb(nacs.ConfigInfo{DataID: "test", Payload: []byte(payload)}, nil)
+}
+
+type appConfig struct {
+	Name    string        `json:"name" yaml:"name" toml:"name" hcl:"name" validate:"required"`
+	Port    int           `json:"port" yaml:"port" toml:"port" hcl:"port,optional" default:"8080"`
+	Timeout time.Duration `json:"timeout" yaml:"timeout" toml:"timeout" default:"5s"`
+}
+
+func TestBind(t *testing.T) {
+	c := &pushConfigor{payload: []byte(`{"name": "app"}`)}
+	var errs []error
+	b, err := nacs.Bind[appConfig](c, nacs.FormatJSON, nacs.WithErrorHandler(func(info nacs.ConfigInfo, err error) {
+		errs = append(errs, err)
+	}))
+	z.Must(err)
+	defer b.Close()
+	assert.Equal(t, appConfig{Name: "app", Port: 8080, Timeout: time.Second * 5}, b.Get())
+
+	var changes [][2]appConfig
+	b.OnChange(func(prev, curr appConfig) { changes = append(changes, [2]appConfig{prev, curr}) })
+
+	// formatting is not a change
+	c.push(`{ "port": 8080, "name": "app" }`)
+	assert.Empty(t, changes)
+
+	c.push(`{"name": "app", "port": 9090}`)
+	assert.Len(t, changes, 1)
+	assert.Equal(t, 9090, changes[0][1].Port)
+	assert.Equal(t, 9090, b.Get().Port)
+
+	// bad configs keep the last good value
+	c.push(`{"name": `)
+	c.push(`{"port": 1}`)
+	c.cb(nacs.ConfigInfo{}, errors.New("boom"))
+	assert.Len(t, errs, 3)
+	assert.Len(t, changes, 1)
+	assert.Equal(t, 9090, b.Get().Port)
+}
+
+func TestBindFormats(t *testing.T) {
+	for format, payload := range map[nacs.Format]string{
+		nacs.FormatJSON: `{"name": "app", "port": 1}`,
+		nacs.FormatYAML: "name: app\nport: 1\n",
+		nacs.FormatTOML: "name = \"app\"\nport = 1\n",
+		nacs.FormatHCL:  "name = \"app\"\nport = 1\n",
+	} {
+		b, err := nacs.Bind[appConfig](&pushConfigor{payload: []byte(payload)}, format)
+		z.Must(err)
+		assert.Equal(t, appConfig{Name: "app", Port: 1, Timeout: time.Second * 5}, b.Get(), format)
+		b.Close()
+	}
+
+	_, err := nacs.Bind[appConfig](&pushConfigor{}, "ini")
+	assert.Error(t, err)
+
+	// the initial config must be valid
+	_, err = nacs.Bind[appConfig](&pushConfigor{payload: []byte(`{}`)}, nacs.FormatJSON)
+	assert.Error(t, err)
+
+	// the loader decides defaults and validation
+	b, err := nacs.Bind[appConfig](&pushConfigor{payload: []byte(`{}`)}, nacs.FormatJSON, nacs.WithLoader(&configor.Configor{}))
+	z.Must(err)
+	assert.Equal(t, 8080, b.Get().Port)
+	b.Close()
+}
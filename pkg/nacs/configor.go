@@ -1,6 +1,11 @@
 package nacs
 
-import "context"
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
 
 // ConfigInfo contains configuration data and metadata
 type ConfigInfo struct {
@@ -17,3 +22,34 @@ type Configor interface {
 	Monitor(cb func(info ConfigInfo, err error)) (context.CancelFunc, error)
 	Close() error
 }
+
+// ErrConflict is returned by Publisher.Publish if the config is changed by others meanwhile
+var ErrConflict = errors.New("nacs: config version conflict")
+
+// AnyVersion makes Publisher.Publish skip the version check
+const AnyVersion int64 = -1
+
+// ConfigVersion is a published version of the config
+type ConfigVersion struct {
+	Version int64     // backend specific version, greater is newer
+	Payload []byte    // configuration data
+	Time    time.Time // publish time, zero if the backend does not record it
+}
+
+// Publisher publishes configs, it is implemented by the configors which support writing
+type Publisher interface {
+	// Publish publishes the payload as a compare-and-swap on the current version
+	// expect is the current version, 0 expects no config and AnyVersion skips the check.
+	// ErrConflict is returned if the version does not match, otherwise the new version.
+	Publish(ctx context.Context, payload []byte, expect int64) (int64, error)
+
+	// Delete deletes the config
+	Delete(ctx context.Context) error
+
+	// History returns the published versions, the latest first
+	// limit is the max number of versions returned, 0 means no limit
+	History(ctx context.Context, limit int) ([]ConfigVersion, error)
+
+	// Rollback publishes the payload of the version again and returns the new version
+	Rollback(ctx context.Context, version int64) (int64, error)
+}
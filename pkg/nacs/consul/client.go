@@ -0,0 +1,378 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/cocktail828/go-tools/pkg/nacs"
+	"github.com/pkg/errors"
+)
+
+var _ nacs.Registry = &ConsulClient{}
+var _ nacs.Configor = &ConsulClient{}
+
+func init() {
+	nacs.RegisterRegistry("consul", func(u *url.URL) (nacs.Registry, error) {
+		c, err := NewConsulClient(u)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	})
+	nacs.RegisterConfigor("consul", func(u *url.URL) (nacs.Configor, error) {
+		c, err := NewConsulClient(u)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	})
+}
+
+const (
+	checkTTL  = "ttl"  // the client heartbeats the check itself
+	checkTCP  = "tcp"  // the consul agent dials $host:$port
+	checkHTTP = "http" // the consul agent requests http://$host:$port$check_path
+
+	// reserved metadata keys, consul only accepts [A-Za-z0-9_-] as meta key
+	metaNamespace = "nacs_namespace"
+)
+
+// consul URI format: consul://host:8500?namespace=$namespace&service=$service&version=$version&check=ttl&ttl=10
+type ConsulClient struct {
+	namespace  string
+	service    string
+	version    string
+	ttl        int64  // check ttl or interval in seconds
+	check      string // ttl, tcp, http
+	checkPath  string // path of the http check
+	baseClient *BaseConsulClient
+}
+
+// ServiceName returns the service name registered in consul: $service
+// Version and namespace are carried by the tags and metadata of the instance.
+func (c *ConsulClient) ServiceName() string { return c.service }
+
+// ServiceID returns the instance ID in consul format: $namespace:$service@$version:$host:$port
+// It is used to identify the service instance in consul.
+func (c *ConsulClient) ServiceID(host string, port uint) string {
+	return fmt.Sprintf("%s:%s@%s:%s:%d", c.namespace, c.service, c.version, host, port)
+}
+
+// ConfigID returns the config key in consul KV: $namespace/$service@$version/config
+// It is used to identify the config in consul.
+func (c *ConsulClient) ConfigID() string {
+	return fmt.Sprintf("%s/%s@%s/config", c.namespace, c.service, c.version)
+}
+
+// NewConsulClient creates a new consul-backed client. The URL query should contain namespace, service, version
+// The optional query 'check' selects the health check kind (ttl, tcp, http), 'ttl' the check ttl or
+// interval in seconds and 'check_path' the path requested by the http check.
+func NewConsulClient(u *url.URL) (*ConsulClient, error) {
+	baseClient, err := NewBaseConsulClient(u)
+	if err != nil {
+		return nil, err
+	}
+
+	query := u.Query()
+	c, err := baseClient.Spawn(query.Get("namespace"), query.Get("service"), query.Get("version"))
+	if err != nil {
+		return nil, err
+	}
+
+	if str := query.Get("ttl"); str != "" {
+		if val, err := strconv.ParseInt(str, 10, 64); err == nil && val > 0 {
+			c.ttl = val
+		}
+	}
+
+	switch check := query.Get("check"); check {
+	case "", checkTTL:
+	case checkTCP, checkHTTP:
+		c.check = check
+		c.checkPath = query.Get("check_path")
+	default:
+		c.Close()
+		return nil, errors.Errorf("consul: unsupported check %q", check)
+	}
+	return c, nil
+}
+
+// Ancestor returns the base consul client
+func (c *ConsulClient) Ancestor() *BaseConsulClient { return c.baseClient }
+
+// Share will create a new client with different namespace, service, version
+// But shared the same base client and health check settings
+func (c *ConsulClient) Share(namespace, service, version string) (*ConsulClient, error) {
+	nc, err := c.baseClient.Spawn(namespace, service, version)
+	if err != nil {
+		return nil, err
+	}
+	nc.ttl, nc.check, nc.checkPath = c.ttl, c.check, c.checkPath
+	return nc, nil
+}
+
+func (c *ConsulClient) Close() error {
+	return c.baseClient.Close()
+}
+
+type agentCheck struct {
+	CheckID                        string `json:",omitempty"`
+	Name                           string `json:",omitempty"`
+	TTL                            string `json:",omitempty"`
+	TCP                            string `json:",omitempty"`
+	HTTP                           string `json:",omitempty"`
+	Interval                       string `json:",omitempty"`
+	Timeout                        string `json:",omitempty"`
+	DeregisterCriticalServiceAfter string `json:",omitempty"`
+}
+
+type agentService struct {
+	ID      string
+	Service string `json:",omitempty"`
+	Name    string `json:",omitempty"`
+	Tags    []string
+	Address string
+	Port    uint
+	Meta    map[string]string
+	Check   *agentCheck `json:",omitempty"`
+}
+
+type serviceEntry struct {
+	Service agentService
+}
+
+func (c *ConsulClient) newCheck(inst nacs.Instance) *agentCheck {
+	ttl := time.Duration(c.ttl) * time.Second
+	check := &agentCheck{
+		CheckID:                        "service:" + c.ServiceID(inst.Host, inst.Port),
+		Name:                           "nacs " + c.check + " check",
+		DeregisterCriticalServiceAfter: max(ttl*3, time.Minute).String(),
+	}
+
+	hostport := net.JoinHostPort(inst.Host, strconv.FormatUint(uint64(inst.Port), 10))
+	switch c.check {
+	case checkTCP:
+		check.TCP = hostport
+		check.Interval = ttl.String()
+		check.Timeout = (ttl / 2).String()
+	case checkHTTP:
+		check.HTTP = "http://" + hostport + c.checkPath
+		check.Interval = ttl.String()
+		check.Timeout = (ttl / 2).String()
+	default:
+		check.TTL = ttl.String()
+	}
+	return check
+}
+
+func (c *ConsulClient) passTTL(ctx context.Context, checkID string) error {
+	_, err := c.baseClient.do(ctx, http.MethodPut, "/v1/agent/check/pass/"+url.PathEscape(checkID), nil, nil, nil)
+	return err
+}
+
+func (c *ConsulClient) Register(ctx context.Context, inst nacs.Instance) (context.CancelFunc, error) {
+	meta := make(map[string]string, len(inst.Meta)+1)
+	for k, v := range inst.Meta {
+		meta[k] = v
+	}
+	meta[metaNamespace] = c.namespace
+
+	check := c.newCheck(inst)
+	if _, err := c.baseClient.do(ctx, http.MethodPut, "/v1/agent/service/register", nil, agentService{
+		ID:      c.ServiceID(inst.Host, inst.Port),
+		Name:    c.ServiceName(),
+		Tags:    []string{c.version},
+		Address: inst.Host,
+		Port:    inst.Port,
+		Meta:    meta,
+		Check:   check,
+	}, nil); err != nil {
+		return nil, err
+	}
+
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	if c.check == checkTTL {
+		// TTL checks start in critical state, pass it at once
+		if err := c.passTTL(ctx, check.CheckID); err != nil {
+			cancel()
+			c.DeRegister(context.Background(), inst)
+			return nil, err
+		}
+
+		go func() {
+			ticker := time.NewTicker(time.Second * time.Duration(c.ttl) / 3)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-cancelCtx.Done():
+					return
+				case <-ticker.C:
+					c.passTTL(cancelCtx, check.CheckID)
+				}
+			}
+		}()
+	}
+
+	return func() {
+		cancel()
+		c.DeRegister(context.Background(), inst)
+	}, nil
+}
+
+func (c *ConsulClient) DeRegister(ctx context.Context, inst nacs.Instance) error {
+	_, err := c.baseClient.do(ctx, http.MethodPut, "/v1/agent/service/deregister/"+url.PathEscape(c.ServiceID(inst.Host, inst.Port)), nil, nil, nil)
+	return err
+}
+
+func (c *ConsulClient) toInstances(entries []serviceEntry) []nacs.Instance {
+	result := make([]nacs.Instance, 0, len(entries))
+	for _, entry := range entries {
+		svc := entry.Service
+		if svc.Meta[metaNamespace] != c.namespace {
+			continue
+		}
+
+		var meta map[string]string
+		for k, v := range svc.Meta {
+			if k == metaNamespace {
+				continue
+			}
+			if meta == nil {
+				meta = make(map[string]string, len(svc.Meta))
+			}
+			meta[k] = v
+		}
+
+		result = append(result, nacs.Instance{
+			Service: svc.Service,
+			Version: c.version,
+			Host:    svc.Address,
+			Port:    svc.Port,
+			Meta:    meta,
+		})
+	}
+	return result
+}
+
+func (c *ConsulClient) healthQuery() url.Values {
+	return url.Values{"passing": {"1"}, "tag": {c.version}}
+}
+
+func (c *ConsulClient) Discover(ctx context.Context) ([]nacs.Instance, error) {
+	var entries []serviceEntry
+	if _, err := c.baseClient.do(ctx, http.MethodGet, "/v1/health/service/"+url.PathEscape(c.ServiceName()), c.healthQuery(), nil, &entries); err != nil {
+		if errors.Is(err, errNotFound) {
+			return []nacs.Instance{}, nil
+		}
+		return nil, err
+	}
+	return c.toInstances(entries), nil
+}
+
+// blocking runs consul blocking queries on path until ctx is canceled.
+// The callback is invoked whenever the 'X-Consul-Index' moves forward.
+func blocking[T any](ctx context.Context, c *BaseConsulClient, path string, query url.Values, callback func(T, error)) {
+	var index uint64
+	for ctx.Err() == nil {
+		q := url.Values{}
+		for k, v := range query {
+			q[k] = v
+		}
+		if index > 0 {
+			q.Set("index", strconv.FormatUint(index, 10))
+			q.Set("wait", c.waitTime.String())
+		}
+
+		var val T
+		newIndex, err := c.do(ctx, http.MethodGet, path, q, nil, &val)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil && !errors.Is(err, errNotFound) {
+			callback(val, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		// the index must be greater than zero and it may go backwards, e.g. the raft snapshot is restored
+		if newIndex == 0 || newIndex < index {
+			index = 0
+			newIndex = 1
+		}
+		if newIndex == index {
+			continue
+		}
+
+		prev := index
+		index = newIndex
+		if prev > 0 {
+			callback(val, err)
+		}
+	}
+}
+
+func (c *ConsulClient) Watch(callback func([]nacs.Instance, error)) (context.CancelFunc, error) {
+	if callback == nil {
+		return nil, errors.New("callback is nil")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go blocking(ctx, c.baseClient, "/v1/health/service/"+url.PathEscape(c.ServiceName()), c.healthQuery(), func(entries []serviceEntry, err error) {
+		if err != nil && !errors.Is(err, errNotFound) {
+			callback(nil, err)
+			return
+		}
+		callback(c.toInstances(entries), nil)
+	})
+
+	return cancel, nil
+}
+
+func (c *ConsulClient) Load(ctx context.Context) (nacs.ConfigInfo, error) {
+	var payload []byte
+	if _, err := c.baseClient.do(ctx, http.MethodGet, "/v1/kv/"+c.ConfigID(), url.Values{"raw": {"1"}}, nil, &payload); err != nil {
+		if errors.Is(err, errNotFound) {
+			return nacs.ConfigInfo{}, errors.Errorf("config %s not found", c.ConfigID())
+		}
+		return nacs.ConfigInfo{}, err
+	}
+
+	return nacs.ConfigInfo{
+		DataID:  c.ConfigID(),
+		Payload: payload,
+	}, nil
+}
+
+func (c *ConsulClient) Monitor(cb func(nacs.ConfigInfo, error)) (context.CancelFunc, error) {
+	if cb == nil {
+		return nil, errors.New("callback is nil")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go blocking(ctx, c.baseClient, "/v1/kv/"+c.ConfigID(), url.Values{"raw": {"1"}}, func(payload []byte, err error) {
+		if errors.Is(err, errNotFound) {
+			err = errors.Errorf("config %s not found", c.ConfigID())
+		}
+		cb(nacs.ConfigInfo{DataID: c.ConfigID(), Payload: payload}, err)
+	})
+
+	return cancel, nil
+}
+
+// WatchEvents diffs the instance lists delivered by Watch into incremental events
+func (c *ConsulClient) WatchEvents(callback func([]nacs.Event, error)) (context.CancelFunc, error) {
+	if callback == nil {
+		return nil, errors.New("callback is nil")
+	}
+	return nacs.WatchDiff(c, callback)
+}
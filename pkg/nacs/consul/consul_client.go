@@ -0,0 +1,168 @@
+package consul
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// errNotFound is returned when consul answers 404 for a key or service
+var errNotFound = errors.New("consul: not found")
+
+// consul URI format: consul://$token@host:8500?dc=$datacenter&scheme=https&namespace=$namespace&service=$service&version=$version
+type BaseConsulClient struct {
+	refCnt     atomic.Int32
+	client     *http.Client
+	endpoint   string // scheme://host:port
+	token      string // ACL token, sent as 'X-Consul-Token'
+	datacenter string
+	waitTime   time.Duration // max blocking query time
+}
+
+// NewBaseConsulClient creates a new consul-backed client.
+func NewBaseConsulClient(u *url.URL) (*BaseConsulClient, error) {
+	if u.Host == "" {
+		return nil, errors.New("consul: host is empty")
+	}
+
+	query := u.Query()
+	scheme := query.Get("scheme")
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	token := query.Get("token")
+	if token == "" && u.User != nil {
+		token = u.User.Username()
+	}
+
+	waitTime := time.Minute
+	if str := query.Get("wait"); str != "" {
+		if val, err := time.ParseDuration(str); err == nil && val > 0 {
+			waitTime = val
+		}
+	}
+
+	c := &BaseConsulClient{
+		client:     &http.Client{},
+		endpoint:   scheme + "://" + u.Host,
+		token:      token,
+		datacenter: query.Get("dc"),
+		waitTime:   waitTime,
+	}
+
+	c.refCnt.Add(1)
+	return c, nil
+}
+
+// Spawn will create a new client with different namespace, service, version
+// But shared the same http client
+// Notice, the http client will be close only when the reference count is 0
+func (c *BaseConsulClient) Spawn(namespace, service, version string) (*ConsulClient, error) {
+	if namespace == "" {
+		return nil, errors.New("namespace is empty")
+	}
+	if service == "" {
+		return nil, errors.New("service is empty")
+	}
+	if version == "" {
+		return nil, errors.New("version is empty")
+	}
+
+	c.refCnt.Add(1)
+	return &ConsulClient{
+		namespace:  namespace,
+		service:    service,
+		version:    version,
+		ttl:        10,
+		check:      checkTTL,
+		baseClient: c,
+	}, nil
+}
+
+func (c *BaseConsulClient) Endpoint() string   { return c.endpoint }
+func (c *BaseConsulClient) Datacenter() string { return c.datacenter }
+
+func (c *BaseConsulClient) Close() error {
+	if c.refCnt.Add(-1) == 0 {
+		c.client.CloseIdleConnections()
+	}
+	return nil
+}
+
+func (c *BaseConsulClient) MustClose() {
+	c.refCnt.Add(-10000) // set a big negative number to make sure it will be closed
+	c.client.CloseIdleConnections()
+}
+
+// do sends a request to the consul HTTP API and decodes the JSON response into out.
+// If out is a *[]byte, the raw response body is stored instead.
+// It returns the 'X-Consul-Index' of the response, which is used by blocking queries.
+func (c *BaseConsulClient) do(ctx context.Context, method, path string, query url.Values, in, out any) (uint64, error) {
+	if query == nil {
+		query = url.Values{}
+	}
+	if c.datacenter != "" {
+		query.Set("dc", c.datacenter)
+	}
+
+	var body io.Reader
+	switch v := in.(type) {
+	case nil:
+	case []byte:
+		body = bytes.NewReader(v)
+	default:
+		buf, err := json.Marshal(in)
+		if err != nil {
+			return 0, err
+		}
+		body = bytes.NewReader(buf)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.endpoint+path+"?"+query.Encode(), body)
+	if err != nil {
+		return 0, err
+	}
+	if c.token != "" {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	index, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	if resp.StatusCode == http.StatusNotFound {
+		return index, errNotFound
+	}
+
+	payload, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return index, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return index, errors.Errorf("consul: %s %s failed with status %d: %s", method, path, resp.StatusCode, payload)
+	}
+
+	switch v := out.(type) {
+	case nil:
+	case *[]byte:
+		*v = payload
+	default:
+		if err := json.Unmarshal(payload, out); err != nil {
+			return index, err
+		}
+	}
+	return index, nil
+}
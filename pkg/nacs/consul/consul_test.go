@@ -0,0 +1,352 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cocktail828/go-tools/pkg/nacs"
+	"github.com/cocktail828/go-tools/z"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeConsul is a minimal stand-in of the consul HTTP API, including blocking queries.
+type fakeConsul struct {
+	mu       sync.Mutex
+	index    uint64
+	changed  chan struct{}
+	services map[string]agentService
+	passing  map[string]bool // check ID -> passing
+	kv       map[string][]byte
+	token    string
+}
+
+func newFakeConsul() *fakeConsul {
+	return &fakeConsul{
+		index:    1,
+		changed:  make(chan struct{}),
+		services: map[string]agentService{},
+		passing:  map[string]bool{},
+		kv:       map[string][]byte{},
+	}
+}
+
+func (f *fakeConsul) bumpLocked() {
+	f.index++
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+// wait blocks until the index moves past 'index' query param or the wait time elapses
+func (f *fakeConsul) wait(r *http.Request) {
+	index, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64)
+	wait, err := time.ParseDuration(r.URL.Query().Get("wait"))
+	if err != nil {
+		wait = time.Minute
+	}
+
+	f.mu.Lock()
+	if index == 0 || index < f.index {
+		f.mu.Unlock()
+		return
+	}
+	ch := f.changed
+	f.mu.Unlock()
+
+	select {
+	case <-ch:
+	case <-time.After(wait):
+	case <-r.Context().Done():
+	}
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	token := f.token
+	f.mu.Unlock()
+	if token != "" && r.Header.Get("X-Consul-Token") != token {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	path := r.URL.Path
+	switch {
+	case r.Method == http.MethodPut && path == "/v1/agent/service/register":
+		var svc agentService
+		if err := json.NewDecoder(r.Body).Decode(&svc); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		svc.Service = svc.Name
+		f.services[svc.ID] = svc
+		f.passing[svc.Check.CheckID] = svc.Check.TTL == ""
+		f.bumpLocked()
+		f.mu.Unlock()
+
+	case r.Method == http.MethodPut && strings.HasPrefix(path, "/v1/agent/service/deregister/"):
+		id := strings.TrimPrefix(path, "/v1/agent/service/deregister/")
+		f.mu.Lock()
+		if svc, ok := f.services[id]; ok {
+			delete(f.services, id)
+			delete(f.passing, svc.Check.CheckID)
+			f.bumpLocked()
+		}
+		f.mu.Unlock()
+
+	case r.Method == http.MethodPut && strings.HasPrefix(path, "/v1/agent/check/pass/"):
+		id := strings.TrimPrefix(path, "/v1/agent/check/pass/")
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		passing, ok := f.passing[id]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if !passing {
+			f.passing[id] = true
+			f.bumpLocked()
+		}
+
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/v1/health/service/"):
+		f.wait(r)
+		name := strings.TrimPrefix(path, "/v1/health/service/")
+		tag := r.URL.Query().Get("tag")
+		f.mu.Lock()
+		entries := []serviceEntry{}
+		for _, svc := range f.services {
+			if svc.Service != name || (tag != "" && !slices.Contains(svc.Tags, tag)) {
+				continue
+			}
+			if r.URL.Query().Get("passing") != "" && !f.passing[svc.Check.CheckID] {
+				continue
+			}
+			entries = append(entries, serviceEntry{Service: svc})
+		}
+		w.Header().Set("X-Consul-Index", strconv.FormatUint(f.index, 10))
+		f.mu.Unlock()
+		json.NewEncoder(w).Encode(entries)
+
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/v1/kv/"):
+		f.wait(r)
+		f.mu.Lock()
+		val, ok := f.kv[strings.TrimPrefix(path, "/v1/kv/")]
+		w.Header().Set("X-Consul-Index", strconv.FormatUint(f.index, 10))
+		f.mu.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(val)
+
+	case r.Method == http.MethodPut && strings.HasPrefix(path, "/v1/kv/"):
+		val, _ := io.ReadAll(r.Body)
+		f.mu.Lock()
+		f.kv[strings.TrimPrefix(path, "/v1/kv/")] = val
+		f.bumpLocked()
+		f.mu.Unlock()
+		w.Write([]byte("true"))
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeConsul) put(key string, val []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.kv[key] = val
+	f.bumpLocked()
+}
+
+func newTestClient(t *testing.T, query string) (*fakeConsul, *ConsulClient) {
+	fake := newFakeConsul()
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	u, err := url.ParseRequestURI("consul://" + strings.TrimPrefix(srv.URL, "http://") + "?namespace=myns&service=asfd&version=v1.0.0&wait=1s" + query)
+	z.Must(err)
+
+	ncs, err := NewConsulClient(u)
+	z.Must(err)
+	t.Cleanup(func() { ncs.Close() })
+	return fake, ncs
+}
+
+func TestNewConsulClient(t *testing.T) {
+	for _, uri := range []string{
+		"consul://127.0.0.1:8500?service=asfd&version=v1.0.0",
+		"consul://127.0.0.1:8500?namespace=myns&version=v1.0.0",
+		"consul://127.0.0.1:8500?namespace=myns&service=asfd",
+		"consul://127.0.0.1:8500?namespace=myns&service=asfd&version=v1.0.0&check=grpc",
+	} {
+		u, err := url.ParseRequestURI(uri)
+		z.Must(err)
+		_, err = NewConsulClient(u)
+		assert.Error(t, err, uri)
+	}
+
+	u, err := url.ParseRequestURI("consul://secret@127.0.0.1:8500?namespace=myns&service=asfd&version=v1.0.0&check=http&check_path=/healthz&ttl=3&dc=dc1")
+	z.Must(err)
+	ncs, err := NewConsulClient(u)
+	z.Must(err)
+	defer ncs.Close()
+
+	assert.Equal(t, "http://127.0.0.1:8500", ncs.Ancestor().Endpoint())
+	assert.Equal(t, "dc1", ncs.Ancestor().Datacenter())
+	assert.Equal(t, "myns/asfd@v1.0.0/config", ncs.ConfigID())
+	assert.Equal(t, "myns:asfd@v1.0.0:127.0.0.1:8080", ncs.ServiceID("127.0.0.1", 8080))
+
+	check := ncs.newCheck(nacs.Instance{Host: "127.0.0.1", Port: 8080})
+	assert.Equal(t, "http://127.0.0.1:8080/healthz", check.HTTP)
+	assert.Equal(t, "3s", check.Interval)
+	assert.Empty(t, check.TTL)
+
+	shared, err := ncs.Share("otherns", "other", "v2")
+	z.Must(err)
+	defer shared.Close()
+	assert.Equal(t, "otherns/other@v2/config", shared.ConfigID())
+	assert.Equal(t, checkHTTP, shared.check)
+	assert.Equal(t, int32(3), ncs.Ancestor().refCnt.Load())
+}
+
+func TestNaming(t *testing.T) {
+	_, ncs := newTestClient(t, "")
+
+	instance := nacs.Instance{
+		Service: "asfd",
+		Version: "v1.0.0",
+		Host:    "127.0.0.1",
+		Port:    8080,
+		Meta:    map[string]string{"a": "b"},
+	}
+
+	insts, err := ncs.Discover(context.Background())
+	z.Must(err)
+	assert.Empty(t, insts)
+
+	ch := make(chan []nacs.Instance, 16)
+	cancel, err := ncs.Watch(func(insts []nacs.Instance, err error) {
+		z.Must(err)
+		ch <- insts
+	})
+	z.Must(err)
+	defer cancel()
+	time.Sleep(time.Millisecond * 100)
+
+	deregister, err := ncs.Register(context.Background(), instance)
+	z.Must(err)
+
+	expect := []nacs.Instance{instance}
+	insts, err = ncs.Discover(context.Background())
+	z.Must(err)
+	assert.Equal(t, expect, insts)
+
+	// instances of other namespaces must be invisible
+	other, err := ncs.Share("otherns", "asfd", "v1.0.0")
+	z.Must(err)
+	defer other.Close()
+	insts, err = other.Discover(context.Background())
+	z.Must(err)
+	assert.Empty(t, insts)
+
+	waitFor := func(expect []nacs.Instance) {
+		for {
+			select {
+			case insts := <-ch:
+				if len(insts) == len(expect) {
+					assert.Equal(t, expect, insts)
+					return
+				}
+			case <-time.After(time.Second * 3):
+				t.Fatalf("watch did not observe %v", expect)
+			}
+		}
+	}
+	waitFor(expect)
+
+	deregister()
+	waitFor([]nacs.Instance{})
+}
+
+func TestConfigor(t *testing.T) {
+	fake, ncs := newTestClient(t, "")
+	fake.mu.Lock()
+	fake.token = "secret"
+	fake.mu.Unlock()
+
+	// the ACL token is required
+	_, err := ncs.Load(context.Background())
+	assert.Error(t, err)
+	ncs.Ancestor().token = "secret"
+
+	_, err = ncs.Load(context.Background())
+	assert.ErrorContains(t, err, "not found")
+
+	fake.put(ncs.ConfigID(), []byte("hello world"))
+	info, err := ncs.Load(context.Background())
+	z.Must(err)
+	assert.Equal(t, ncs.ConfigID(), info.DataID)
+	assert.Equal(t, "hello world", string(info.Payload))
+
+	ch := make(chan nacs.ConfigInfo, 1)
+	cancel, err := ncs.Monitor(func(info nacs.ConfigInfo, err error) {
+		z.Must(err)
+		ch <- info
+	})
+	z.Must(err)
+	defer cancel()
+
+	time.Sleep(time.Millisecond * 100)
+	fake.put(ncs.ConfigID(), []byte("updated_value"))
+
+	select {
+	case info := <-ch:
+		assert.Equal(t, "updated_value", string(info.Payload))
+	case <-time.After(time.Second * 3):
+		t.Fatal("Monitor did not trigger within timeout period")
+	}
+}
+
+func TestWatchEvents(t *testing.T) {
+	_, ncs := newTestClient(t, "")
+
+	a := nacs.Instance{Service: "asfd", Version: "v1.0.0", Host: "127.0.0.1", Port: 8080}
+	_, err := ncs.Register(context.Background(), a)
+	z.Must(err)
+
+	ch := make(chan []nacs.Event, 16)
+	cancel, err := ncs.WatchEvents(func(evs []nacs.Event, err error) {
+		z.Must(err)
+		ch <- evs
+	})
+	z.Must(err)
+	defer cancel()
+
+	expect := func(evs []nacs.Event) {
+		select {
+		case got := <-ch:
+			assert.Equal(t, evs, got)
+		case <-time.After(time.Second * 3):
+			t.Fatalf("watch did not observe %v", evs)
+		}
+	}
+	expect([]nacs.Event{{Type: nacs.EventAdded, Instance: a}})
+
+	b := nacs.Instance{Service: "asfd", Version: "v1.0.0", Host: "127.0.0.1", Port: 8081}
+	_, err = ncs.Register(context.Background(), b)
+	z.Must(err)
+	expect([]nacs.Event{{Type: nacs.EventAdded, Instance: b}})
+
+	z.Must(ncs.DeRegister(context.Background(), a))
+	expect([]nacs.Event{{Type: nacs.EventRemoved, Instance: a}})
+}
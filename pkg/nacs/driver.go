@@ -0,0 +1,110 @@
+package nacs
+
+import (
+	"net/url"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// RegistryDriver creates a Registry from a driver-specific URL, e.g. etcd://host:2379?namespace=...
+type RegistryDriver func(u *url.URL) (Registry, error)
+
+// ConfigorDriver creates a Configor from a driver-specific URL, e.g. file:///etc/app.toml
+type ConfigorDriver func(u *url.URL) (Configor, error)
+
+var (
+	driversMu       sync.RWMutex
+	registryDrivers = make(map[string]RegistryDriver)
+	configorDrivers = make(map[string]ConfigorDriver)
+)
+
+// RegisterRegistry makes a registry driver available by the provided URL scheme.
+// If RegisterRegistry is called twice with the same scheme or if driver is nil,
+// it panics.
+func RegisterRegistry(scheme string, driver RegistryDriver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	if driver == nil {
+		panic("nacs: RegisterRegistry driver is nil")
+	}
+	if _, dup := registryDrivers[scheme]; dup {
+		panic("nacs: RegisterRegistry called twice for driver " + scheme)
+	}
+	registryDrivers[scheme] = driver
+}
+
+// RegisterConfigor makes a configor driver available by the provided URL scheme.
+// If RegisterConfigor is called twice with the same scheme or if driver is nil,
+// it panics.
+func RegisterConfigor(scheme string, driver ConfigorDriver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	if driver == nil {
+		panic("nacs: RegisterConfigor driver is nil")
+	}
+	if _, dup := configorDrivers[scheme]; dup {
+		panic("nacs: RegisterConfigor called twice for driver " + scheme)
+	}
+	configorDrivers[scheme] = driver
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	list := make([]string, 0, len(m))
+	for name := range m {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Registries returns a sorted list of the schemes of the registered registry drivers.
+func Registries() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	return sortedKeys(registryDrivers)
+}
+
+// Configors returns a sorted list of the schemes of the registered configor drivers.
+func Configors() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	return sortedKeys(configorDrivers)
+}
+
+// Open opens a Registry specified by the scheme of the URL.
+// The driver must be registered in advance, usually by importing the driver package, e.g.
+//
+//	import _ "github.com/cocktail828/go-tools/pkg/nacs/etcd"
+func Open(u *url.URL) (Registry, error) {
+	if u == nil {
+		return nil, errors.New("nacs: url is nil")
+	}
+
+	driversMu.RLock()
+	driver, ok := registryDrivers[u.Scheme]
+	driversMu.RUnlock()
+	if !ok {
+		return nil, errors.Errorf("nacs: unknown registry driver %q (forgotten import?)", u.Scheme)
+	}
+	return driver(u)
+}
+
+// OpenConfigor opens a Configor specified by the scheme of the URL.
+// The driver must be registered in advance, usually by importing the driver package, e.g.
+//
+//	import _ "github.com/cocktail828/go-tools/pkg/nacs/native"
+func OpenConfigor(u *url.URL) (Configor, error) {
+	if u == nil {
+		return nil, errors.New("nacs: url is nil")
+	}
+
+	driversMu.RLock()
+	driver, ok := configorDrivers[u.Scheme]
+	driversMu.RUnlock()
+	if !ok {
+		return nil, errors.Errorf("nacs: unknown configor driver %q (forgotten import?)", u.Scheme)
+	}
+	return driver(u)
+}
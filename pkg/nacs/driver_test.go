@@ -0,0 +1,102 @@
+package nacs_test
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cocktail828/go-tools/pkg/nacs"
+	_ "github.com/cocktail828/go-tools/pkg/nacs/consul"
+	_ "github.com/cocktail828/go-tools/pkg/nacs/etcd"
+	_ "github.com/cocktail828/go-tools/pkg/nacs/mdns"
+	_ "github.com/cocktail828/go-tools/pkg/nacs/nacos"
+	_ "github.com/cocktail828/go-tools/pkg/nacs/native"
+	_ "github.com/cocktail828/go-tools/pkg/nacs/static"
+	"github.com/cocktail828/go-tools/z"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDrivers(t *testing.T) {
+	assert.Subset(t, nacs.Registries(), []string{"consul", "etcd", "mdns", "nacos"})
+	assert.Subset(t, nacs.Configors(), []string{"consul", "etcd", "file", "nacos", "static"})
+
+	assert.Panics(t, func() { nacs.RegisterRegistry("etcd", func(u *url.URL) (nacs.Registry, error) { return nil, nil }) })
+	assert.Panics(t, func() { nacs.RegisterConfigor("static", nil) })
+}
+
+func TestOpen(t *testing.T) {
+	for _, uri := range []string{
+		"etcd://127.0.0.1:2379?namespace=myns&service=asfd&version=v1.0.0",
+		"consul://127.0.0.1:8500?namespace=myns&service=asfd&version=v1.0.0",
+		"mdns://?namespace=myns&service=asfd&version=v1.0.0",
+	} {
+		u, err := url.Parse(uri)
+		z.Must(err)
+		r, err := nacs.Open(u)
+		assert.NoError(t, err, uri)
+		assert.NoError(t, r.Close())
+	}
+
+	_, err := nacs.Open(nil)
+	assert.Error(t, err)
+
+	u, _ := url.Parse("zookeeper://127.0.0.1:2181")
+	_, err = nacs.Open(u)
+	assert.ErrorContains(t, err, "forgotten import")
+
+	// file:// only provides a configor
+	u, _ = url.Parse("file:///tmp/config.toml")
+	_, err = nacs.Open(u)
+	assert.Error(t, err)
+
+	// driver errors are returned as is, without a typed nil registry
+	u, _ = url.Parse("etcd://127.0.0.1:2379?service=asfd&version=v1.0.0")
+	r, err := nacs.Open(u)
+	assert.Error(t, err)
+	assert.Nil(t, r)
+}
+
+func TestOpenConfigor(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "config.toml")
+	z.Must(os.WriteFile(fpath, []byte("a = 1"), os.ModePerm))
+
+	for uri, expect := range map[string]string{
+		"file://" + fpath:         "a = 1",
+		"static://?payload=hello": "hello",
+		"static://?payload=aGVsbG8gd29ybGQ%3D&encoding=base64": "hello world",
+	} {
+		u, err := url.Parse(uri)
+		z.Must(err)
+		c, err := nacs.OpenConfigor(u)
+		z.Must(err)
+
+		info, err := c.Load(context.Background())
+		z.Must(err)
+		assert.Equal(t, expect, string(info.Payload))
+		assert.NoError(t, c.Close())
+	}
+
+	u, _ := url.Parse("static://?payload=!!!&encoding=base64")
+	_, err := nacs.OpenConfigor(u)
+	assert.Error(t, err)
+
+	u, _ = url.Parse("mdns://?namespace=myns&service=asfd&version=v1.0.0")
+	_, err = nacs.OpenConfigor(u)
+	assert.ErrorContains(t, err, "unknown configor driver")
+}
+
+func TestCustomDriver(t *testing.T) {
+	nacs.RegisterConfigor("custom", func(u *url.URL) (nacs.Configor, error) {
+		u.Scheme = "static"
+		return nacs.OpenConfigor(u)
+	})
+
+	u, _ := url.Parse("custom://?payload=custom")
+	c, err := nacs.OpenConfigor(u)
+	z.Must(err)
+	info, err := c.Load(context.Background())
+	z.Must(err)
+	assert.Equal(t, "custom", string(info.Payload))
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/cocktail828/go-tools/pkg/nacs"
@@ -12,6 +15,23 @@ import (
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
+func init() {
+	nacs.RegisterRegistry("etcd", func(u *url.URL) (nacs.Registry, error) {
+		c, err := NewEtcdClient(u)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	})
+	nacs.RegisterConfigor("etcd", func(u *url.URL) (nacs.Configor, error) {
+		c, err := NewEtcdClient(u)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	})
+}
+
 // etcd URI format: etcd://host:2379?namespace=$namespace&service=$service&version=$version
 type EtcdClient struct {
 	namespace  string
@@ -125,18 +145,121 @@ func (c *EtcdClient) Discover(ctx context.Context) ([]nacs.Instance, error) {
 
 	res := make([]nacs.Instance, 0, len(resp.Kvs))
 	for _, kv := range resp.Kvs {
-		var inst nacs.Instance
-		if err := json.Unmarshal(kv.Value, &inst); err != nil {
-			continue
+		if inst, ok := decodeInstance(kv.Value); ok {
+			res = append(res, inst)
 		}
-		res = append(res, inst)
 	}
 	return res, nil
 }
 
+func decodeInstance(val []byte) (nacs.Instance, bool) {
+	var inst nacs.Instance
+	if err := json.Unmarshal(val, &inst); err != nil {
+		return inst, false
+	}
+	return inst, true
+}
+
+// resync reads all instances and returns the events turning the known set into them
+func (c *EtcdClient) resync(ctx context.Context, set map[string]nacs.Instance) ([]nacs.Event, int64, error) {
+	resp, err := c.baseClient.client.Get(ctx, c.Prefix()+"/instances/", clientv3.WithPrefix())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	curr := make([]nacs.Instance, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		if inst, ok := decodeInstance(kv.Value); ok {
+			curr = append(curr, inst)
+		}
+	}
+
+	evs := nacs.Diff(nacs.Instances(set), curr)
+	for i := range evs {
+		evs[i].Revision = resp.Header.Revision
+	}
+	nacs.Apply(set, evs)
+	return evs, resp.Header.Revision, nil
+}
+
+// toEvents converts the etcd events into instance events, the previous value is used for deletions
+func (c *EtcdClient) toEvents(wr clientv3.WatchResponse) []nacs.Event {
+	evs := make([]nacs.Event, 0, len(wr.Events))
+	for _, ev := range wr.Events {
+		switch ev.Type {
+		case clientv3.EventTypePut:
+			inst, ok := decodeInstance(ev.Kv.Value)
+			if !ok {
+				continue
+			}
+
+			typ := nacs.EventAdded
+			if !ev.IsCreate() {
+				typ = nacs.EventUpdated
+			}
+			evs = append(evs, nacs.Event{Type: typ, Instance: inst, Revision: ev.Kv.ModRevision})
+
+		case clientv3.EventTypeDelete:
+			var inst nacs.Instance
+			if ev.PrevKv != nil {
+				inst, _ = decodeInstance(ev.PrevKv.Value)
+			}
+			if inst.Host == "" {
+				// no previous value, recover the address from the key
+				host, port, err := net.SplitHostPort(strings.TrimPrefix(string(ev.Kv.Key), c.Prefix()+"/instances/"))
+				if err != nil {
+					continue
+				}
+				p, _ := strconv.ParseUint(port, 10, 64)
+				inst = nacs.Instance{Service: c.service, Version: c.version, Host: host, Port: uint(p)}
+			}
+			evs = append(evs, nacs.Event{Type: nacs.EventRemoved, Instance: inst, Revision: ev.Kv.ModRevision})
+		}
+	}
+	return evs
+}
+
+// Watch delivers the full instance list on every change.
+// The list is maintained from incremental events, no range read is issued per change.
 func (c *EtcdClient) Watch(callback func([]nacs.Instance, error)) (context.CancelFunc, error) {
+	if callback == nil {
+		return nil, errors.New("callback is nil")
+	}
+
+	set := map[string]nacs.Instance{}
+	synced := false
+	return c.WatchEvents(func(evs []nacs.Event, err error) {
+		if err != nil {
+			callback(nil, err)
+			return
+		}
+
+		nacs.Apply(set, evs)
+		// the initial instances are not a change
+		if !synced {
+			synced = true
+			return
+		}
+		callback(nacs.Instances(set), nil)
+	})
+}
+
+// WatchEvents delivers incremental events built from the etcd watch events (with the previous kv).
+// It tracks the last seen revision, a broken watch is resumed from there instead of replaying everything.
+// If the revision has been compacted meanwhile, the instances are read again and the difference is delivered.
+func (c *EtcdClient) WatchEvents(callback func([]nacs.Event, error)) (context.CancelFunc, error) {
+	if callback == nil {
+		return nil, errors.New("callback is nil")
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
-	ch := c.baseClient.client.Watch(ctx, c.Prefix()+"/instances/", clientv3.WithPrefix(), clientv3.WithPrevKV())
+	set := map[string]nacs.Instance{}
+	evs, rev, err := c.resync(ctx, set)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	callback(evs, nil)
 
 	go func() {
 		defer func() {
@@ -146,24 +269,61 @@ func (c *EtcdClient) Watch(callback func([]nacs.Instance, error)) (context.Cance
 			}
 		}()
 
-		for wr := range ch {
-			if wr.Err() != nil {
-				callback(nil, wr.Err())
-				continue
-			}
+		for ctx.Err() == nil {
+			rev = c.watchFrom(ctx, rev, set, callback)
 
-			instances, err := c.Discover(ctx)
-			if err != nil {
-				callback(nil, errors.Wrap(err, "discover instances failed"))
-				continue
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
 			}
-			callback(instances, nil)
 		}
 	}()
 
 	return cancel, nil
 }
 
+// watchFrom watches the instances after rev until the watch breaks, it returns the last seen revision
+func (c *EtcdClient) watchFrom(ctx context.Context, rev int64, set map[string]nacs.Instance, callback func([]nacs.Event, error)) int64 {
+	wctx, wcancel := context.WithCancel(clientv3.WithRequireLeader(ctx))
+	defer wcancel()
+
+	wch := c.baseClient.client.Watch(wctx, c.Prefix()+"/instances/",
+		clientv3.WithPrefix(), clientv3.WithPrevKV(), clientv3.WithRev(rev+1), clientv3.WithProgressNotify())
+	for wr := range wch {
+		if wr.CompactRevision != 0 {
+			// the missed revisions are gone, read all instances again
+			evs, r, err := c.resync(ctx, set)
+			if err != nil {
+				callback(nil, errors.Wrap(err, "resync instances failed"))
+				return rev
+			}
+			if len(evs) > 0 {
+				callback(evs, nil)
+			}
+			return r
+		}
+
+		if wr.Err() != nil {
+			callback(nil, wr.Err())
+			continue
+		}
+
+		if wr.IsProgressNotify() {
+			rev = max(rev, wr.Header.Revision)
+			continue
+		}
+
+		if evs := c.toEvents(wr); len(evs) > 0 {
+			nacs.Apply(set, evs)
+			callback(evs, nil)
+		}
+		if n := len(wr.Events); n > 0 {
+			rev = max(rev, wr.Events[n-1].Kv.ModRevision)
+		}
+	}
+	return rev
+}
+
 func (c *EtcdClient) Load(ctx context.Context) (nacs.ConfigInfo, error) {
 	resp, err := c.baseClient.client.Get(ctx, c.ConfigID())
 	if err != nil {
@@ -2,6 +2,7 @@ package etcd
 
 import (
 	"context"
+	"encoding/json"
 	"net/url"
 	"testing"
 	"time"
@@ -9,6 +10,8 @@ import (
 	"github.com/cocktail828/go-tools/pkg/nacs"
 	"github.com/cocktail828/go-tools/z"
 	"github.com/stretchr/testify/assert"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
 var (
@@ -69,3 +72,44 @@ func TestNaming(t *testing.T) {
 
 	<-ctx.Done()
 }
+
+func TestToEvents(t *testing.T) {
+	inst := nacs.Instance{Service: "asfd", Version: "v1.0.0", Host: "127.0.0.1", Port: 8080}
+	val, err := json.Marshal(inst)
+	z.Must(err)
+	key := []byte(ncs.ServiceKey(inst.Host, inst.Port))
+
+	evs := ncs.toEvents(clientv3.WatchResponse{Events: []*clientv3.Event{
+		{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: key, Value: val, CreateRevision: 5, ModRevision: 5}},
+		{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: key, Value: val, CreateRevision: 5, ModRevision: 6}},
+		{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: key, Value: []byte("invalid"), CreateRevision: 5, ModRevision: 7}},
+		{Type: mvccpb.DELETE, Kv: &mvccpb.KeyValue{Key: key, ModRevision: 8}, PrevKv: &mvccpb.KeyValue{Key: key, Value: val}},
+		{Type: mvccpb.DELETE, Kv: &mvccpb.KeyValue{Key: key, ModRevision: 9}},
+	}})
+
+	assert.Equal(t, []nacs.Event{
+		{Type: nacs.EventAdded, Instance: inst, Revision: 5},
+		{Type: nacs.EventUpdated, Instance: inst, Revision: 6},
+		{Type: nacs.EventRemoved, Instance: inst, Revision: 8},
+		{Type: nacs.EventRemoved, Instance: inst, Revision: 9},
+	}, evs)
+}
+
+func TestPublisher(t *testing.T) {
+	ver, err := ncs.Publish(context.Background(), []byte("hello"), nacs.AnyVersion)
+	z.Must(err)
+	_, err = ncs.Publish(context.Background(), []byte("world"), ver-1)
+	assert.ErrorIs(t, err, nacs.ErrConflict)
+
+	info, err := ncs.Load(context.Background())
+	z.Must(err)
+	assert.Equal(t, "hello", string(info.Payload))
+
+	_, err = ncs.Publish(context.Background(), []byte("world"), ver)
+	z.Must(err)
+	_, err = ncs.Rollback(context.Background(), ver)
+	z.Must(err)
+	info, err = ncs.Load(context.Background())
+	z.Must(err)
+	assert.Equal(t, "hello", string(info.Payload))
+}
@@ -0,0 +1,80 @@
+package etcd
+
+import (
+	"context"
+
+	"github.com/cocktail828/go-tools/pkg/nacs"
+	"github.com/pkg/errors"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+var _ nacs.Publisher = &EtcdClient{}
+
+// Publish puts the config in a transaction comparing the mod revision of ConfigID() with expect.
+// The mod revision of the key is the version of the config.
+func (c *EtcdClient) Publish(ctx context.Context, payload []byte, expect int64) (int64, error) {
+	key := c.ConfigID()
+	if expect == nacs.AnyVersion {
+		resp, err := c.baseClient.client.Put(ctx, key, string(payload))
+		if err != nil {
+			return 0, err
+		}
+		return resp.Header.Revision, nil
+	}
+
+	resp, err := c.baseClient.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(key), "=", expect)).
+		Then(clientv3.OpPut(key, string(payload))).
+		Commit()
+	if err != nil {
+		return 0, err
+	}
+	if !resp.Succeeded {
+		return 0, nacs.ErrConflict
+	}
+	return resp.Header.Revision, nil
+}
+
+func (c *EtcdClient) Delete(ctx context.Context) error {
+	_, err := c.baseClient.client.Delete(ctx, c.ConfigID())
+	return err
+}
+
+// History walks the revisions of the config key backwards until it was created or the revision is compacted
+func (c *EtcdClient) History(ctx context.Context, limit int) ([]nacs.ConfigVersion, error) {
+	resp, err := c.baseClient.client.Get(ctx, c.ConfigID())
+	if err != nil {
+		return nil, err
+	}
+
+	var res []nacs.ConfigVersion
+	for len(resp.Kvs) > 0 {
+		kv := resp.Kvs[0]
+		res = append(res, nacs.ConfigVersion{Version: kv.ModRevision, Payload: kv.Value})
+		if (limit > 0 && len(res) >= limit) || kv.Version <= 1 {
+			break
+		}
+
+		resp, err = c.baseClient.client.Get(ctx, c.ConfigID(), clientv3.WithRev(kv.ModRevision-1))
+		if err != nil {
+			if errors.Is(err, rpctypes.ErrCompacted) {
+				break
+			}
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// Rollback reads the config at the revision and puts it again
+func (c *EtcdClient) Rollback(ctx context.Context, version int64) (int64, error) {
+	resp, err := c.baseClient.client.Get(ctx, c.ConfigID(), clientv3.WithRev(version))
+	if err != nil {
+		return 0, err
+	}
+	if len(resp.Kvs) == 0 || resp.Kvs[0].ModRevision != version {
+		return 0, errors.Errorf("config %s has no version %d", c.ConfigID(), version)
+	}
+	return c.Publish(ctx, resp.Kvs[0].Value, nacs.AnyVersion)
+}
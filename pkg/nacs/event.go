@@ -0,0 +1,132 @@
+package nacs
+
+import (
+	"context"
+	"maps"
+	"sort"
+	"sync"
+)
+
+// EventType is the type of an instance change
+type EventType int
+
+const (
+	EventAdded EventType = iota + 1
+	EventUpdated
+	EventRemoved
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventAdded:
+		return "Added"
+	case EventUpdated:
+		return "Updated"
+	case EventRemoved:
+		return "Removed"
+	default:
+		return "Unknown"
+	}
+}
+
+// Event represents a change of a service instance
+type Event struct {
+	Type     EventType
+	Instance Instance // the new instance, or the last known one if removed
+	Revision int64    // backend revision of the change, 0 if the backend has no revision
+}
+
+func instanceEqual(a, b Instance) bool {
+	return a.Service == b.Service && a.Version == b.Version &&
+		a.Host == b.Host && a.Port == b.Port && maps.Equal(a.Meta, b.Meta)
+}
+
+// Diff computes the events turning prev into curr, instances are identified by Instance.Addr
+// The events are sorted by address, removals first.
+func Diff(prev, curr []Instance) []Event {
+	old := make(map[string]Instance, len(prev))
+	for _, inst := range prev {
+		old[inst.Addr()] = inst
+	}
+
+	var added, removed []Event
+	for _, inst := range curr {
+		addr := inst.Addr()
+		if o, ok := old[addr]; !ok {
+			added = append(added, Event{Type: EventAdded, Instance: inst})
+		} else {
+			delete(old, addr)
+			if !instanceEqual(o, inst) {
+				added = append(added, Event{Type: EventUpdated, Instance: inst})
+			}
+		}
+	}
+
+	for _, inst := range old {
+		removed = append(removed, Event{Type: EventRemoved, Instance: inst})
+	}
+
+	byAddr := func(evs []Event) {
+		sort.Slice(evs, func(i, j int) bool { return evs[i].Instance.Addr() < evs[j].Instance.Addr() })
+	}
+	byAddr(removed)
+	byAddr(added)
+	return append(removed, added...)
+}
+
+// Apply applies the events to the instance set which is keyed by Instance.Addr
+func Apply(set map[string]Instance, events []Event) {
+	for _, ev := range events {
+		if ev.Type == EventRemoved {
+			delete(set, ev.Instance.Addr())
+		} else {
+			set[ev.Instance.Addr()] = ev.Instance
+		}
+	}
+}
+
+// Instances returns the instances of the set sorted by Instance.Addr
+func Instances(set map[string]Instance) []Instance {
+	res := make([]Instance, 0, len(set))
+	for _, inst := range set {
+		res = append(res, inst)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Addr() < res[j].Addr() })
+	return res
+}
+
+// WatchDiff implements Registry.WatchEvents for backends which only deliver full instance lists.
+// It discovers the current instances and then diffs every list delivered by Registry.Watch.
+func WatchDiff(r Registry, callback func([]Event, error)) (context.CancelFunc, error) {
+	var mu sync.Mutex
+	var last []Instance
+	cancel, err := r.Watch(func(insts []Instance, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			callback(nil, err)
+			return
+		}
+
+		if evs := Diff(last, insts); len(evs) > 0 {
+			last = insts
+			callback(evs, nil)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	insts, err := r.Discover(context.Background())
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	evs := Diff(last, insts)
+	last = insts
+	callback(evs, nil)
+	return cancel, nil
+}
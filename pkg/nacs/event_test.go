@@ -0,0 +1,93 @@
+package nacs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	a := Instance{Service: "svc", Version: "v1", Host: "10.0.0.1", Port: 80}
+	b := Instance{Service: "svc", Version: "v1", Host: "10.0.0.2", Port: 80}
+	c := Instance{Service: "svc", Version: "v1", Host: "10.0.0.3", Port: 80}
+	b2 := b
+	b2.Meta = map[string]string{"weight": "10"}
+
+	assert.Empty(t, Diff([]Instance{a, b}, []Instance{b, a}))
+	assert.Equal(t, []Event{
+		{Type: EventRemoved, Instance: a},
+		{Type: EventUpdated, Instance: b2},
+		{Type: EventAdded, Instance: c},
+	}, Diff([]Instance{a, b}, []Instance{c, b2}))
+
+	set := map[string]Instance{}
+	Apply(set, Diff(nil, []Instance{c, a, b}))
+	assert.Equal(t, []Instance{a, b, c}, Instances(set))
+	Apply(set, Diff([]Instance{a, b, c}, []Instance{c, b2}))
+	assert.Equal(t, []Instance{b2, c}, Instances(set))
+
+	assert.Equal(t, "Added", EventAdded.String())
+	assert.Equal(t, "Updated", EventUpdated.String())
+	assert.Equal(t, "Removed", EventRemoved.String())
+	assert.Equal(t, "10.0.0.1:80", a.Addr())
+	assert.Equal(t, "[::1]:80", Instance{Host: "::1", Port: 80}.Addr())
+}
+
+// listRegistry delivers full instance lists only
+type listRegistry struct {
+	Registry
+	mu    sync.Mutex
+	insts []Instance
+	cb    func([]Instance, error)
+}
+
+func (r *listRegistry) Discover(ctx context.Context) ([]Instance, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.insts, nil
+}
+
+func (r *listRegistry) Watch(callback func([]Instance, error)) (context.CancelFunc, error) {
+	r.cb = callback
+	return func() {}, nil
+}
+
+func (r *listRegistry) set(insts []Instance, err error) {
+	r.mu.Lock()
+	r.insts = insts
+	r.mu.Unlock()
+	r.cb(insts, err)
+}
+
+func TestWatchDiff(t *testing.T) {
+	a := Instance{Host: "10.0.0.1", Port: 80}
+	b := Instance{Host: "10.0.0.2", Port: 80}
+	r := &listRegistry{insts: []Instance{a}}
+
+	var got [][]Event
+	var errs []error
+	cancel, err := WatchDiff(r, func(evs []Event, err error) {
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		got = append(got, evs)
+	})
+	assert.NoError(t, err)
+	defer cancel()
+
+	r.set([]Instance{a, b}, nil)
+	r.set([]Instance{a, b}, nil) // no change, no callback
+	r.set(nil, errors.New("boom"))
+	r.set([]Instance{b}, nil)
+
+	assert.Equal(t, [][]Event{
+		{{Type: EventAdded, Instance: a}},
+		{{Type: EventAdded, Instance: b}},
+		{{Type: EventRemoved, Instance: a}},
+	}, got)
+	assert.Len(t, errs, 1)
+}
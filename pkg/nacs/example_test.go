@@ -234,3 +234,31 @@ func Example_sharing() {
 	// Now you can use client1 for userservice and client2 for orderservice
 	// They share the same underlying connection to nacos
 }
+
+// Example of picking the backend by the URL scheme
+func ExampleOpen() {
+	// the driver must be registered in advance, e.g.
+	// import _ "github.com/cocktail828/go-tools/pkg/nacs/etcd"
+	u, err := url.Parse("etcd://localhost:2379?namespace=myapp&service=userservice&version=v1.0.0")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	registry, err := nacs.Open(u)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer registry.Close()
+
+	// config may come from another backend
+	u, err = url.Parse("file:///etc/myapp/config.json")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	configor, err := nacs.OpenConfigor(u)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer configor.Close()
+}
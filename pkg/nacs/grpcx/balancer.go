@@ -0,0 +1,94 @@
+package grpcx
+
+import (
+	"strconv"
+
+	"github.com/cocktail828/go-tools/algo/balancer"
+	gbalancer "google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	RoundRobin       = "nacs_round_robin"
+	WeightRoundRobin = "nacs_weight_round_robin"
+	Random           = "nacs_random"
+	Failover         = "nacs_failover"
+)
+
+// DefaultWeight is the node weight if the instance has no valid 'weight' metadata
+var DefaultWeight = 100
+
+func init() {
+	RegisterBalancer(RoundRobin, balancer.NewRoundRobin)
+	RegisterBalancer(WeightRoundRobin, balancer.NewWeightRoundRobin)
+	RegisterBalancer(Random, balancer.NewRandom)
+	RegisterBalancer(Failover, balancer.NewFailover)
+}
+
+// RegisterBalancer registers a gRPC balancer named name which picks the ready SubConns by the strategy.
+// Choose it by the service config, e.g.
+//
+//	grpc.WithDefaultServiceConfig(`{"loadBalancingConfig": [{"nacs_weight_round_robin":{}}]}`)
+func RegisterBalancer(name string, strategy func([]balancer.Node) balancer.Balancer) {
+	gbalancer.Register(base.NewBalancerBuilder(name, &pickerBuilder{strategy: strategy}, base.Config{HealthCheck: true}))
+}
+
+// subConnNode adapts a ready SubConn to balancer.Node
+type subConnNode struct {
+	sc     gbalancer.SubConn
+	weight int
+	region string
+	zone   string
+}
+
+func (n subConnNode) MarkFailure()  {}
+func (n subConnNode) Healthy() bool { return true } // only ready SubConns are picked from
+func (n subConnNode) Weight() int   { return n.weight }
+func (n subConnNode) Value() any    { return n.sc }
+
+// Locality returns the "region" and "zone" metadata of the instance
+func (n subConnNode) Locality() (string, string) { return n.region, n.zone }
+
+type pickerBuilder struct {
+	strategy func([]balancer.Node) balancer.Balancer
+}
+
+func (b *pickerBuilder) Build(info base.PickerBuildInfo) gbalancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(gbalancer.ErrNoSubConnAvailable)
+	}
+
+	nodes := make([]balancer.Node, 0, len(info.ReadySCs))
+	for sc, sci := range info.ReadySCs {
+		meta := MetaOf(sci.Address)
+		weight := DefaultWeight
+		if val, err := strconv.Atoi(meta["weight"]); err == nil && val >= 0 {
+			weight = val
+		}
+		nodes = append(nodes, subConnNode{sc: sc, weight: weight, region: meta["region"], zone: meta["zone"]})
+	}
+	return &picker{balancer: b.strategy(nodes)}
+}
+
+type picker struct {
+	balancer balancer.Balancer
+}
+
+func (p *picker) Pick(gbalancer.PickInfo) (gbalancer.PickResult, error) {
+	n := p.balancer.Pick()
+	if n == nil {
+		return gbalancer.PickResult{}, gbalancer.ErrNoSubConnAvailable
+	}
+
+	return gbalancer.PickResult{
+		SubConn: n.Value().(gbalancer.SubConn),
+		Done: func(di gbalancer.DoneInfo) {
+			// the SubConn is broken, skip it until the picker is rebuilt
+			if status.Code(di.Err) == codes.Unavailable {
+				n.MarkFailure()
+			}
+		},
+	}, nil
+}
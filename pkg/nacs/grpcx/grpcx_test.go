@@ -0,0 +1,145 @@
+package grpcx
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cocktail828/go-tools/pkg/nacs"
+	"github.com/cocktail828/go-tools/protocol/messagepb"
+	"github.com/cocktail828/go-tools/z"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/resolver"
+)
+
+type echoServer struct {
+	messagepb.UnimplementedVersatileServer
+	addr string
+}
+
+// Any answers the address of the server
+func (s *echoServer) Any(ctx context.Context, in *messagepb.Request) (*messagepb.Response, error) {
+	return &messagepb.Response{Message: s.addr}, nil
+}
+
+func startServer(t *testing.T, meta map[string]string) nacs.Instance {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	z.Must(err)
+
+	srv := grpc.NewServer()
+	messagepb.RegisterVersatileServer(srv, &echoServer{addr: ln.Addr().String()})
+	go srv.Serve(ln)
+	t.Cleanup(srv.Stop)
+
+	addr := ln.Addr().(*net.TCPAddr)
+	return nacs.Instance{Service: "echo", Version: "v1", Host: addr.IP.String(), Port: uint(addr.Port), Meta: meta}
+}
+
+// fakeRegistry delivers the events pushed by the test
+type fakeRegistry struct {
+	nacs.Registry
+	mu       sync.Mutex
+	insts    []nacs.Instance
+	callback func([]nacs.Event, error)
+}
+
+func (r *fakeRegistry) WatchEvents(callback func([]nacs.Event, error)) (context.CancelFunc, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.callback = callback
+	callback(nacs.Diff(nil, r.insts), nil)
+	return func() {}, nil
+}
+
+func (r *fakeRegistry) set(insts []nacs.Instance) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	evs := nacs.Diff(r.insts, insts)
+	r.insts = insts
+	r.callback(evs, nil)
+}
+
+func dial(t *testing.T, reg nacs.Registry, lb string) messagepb.VersatileClient {
+	cc, err := grpc.NewClient("nacs-test:///echo",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithResolvers(NewRegistryBuilder("nacs-test", reg)),
+		grpc.WithDefaultServiceConfig(`{"loadBalancingConfig": [{"`+lb+`":{}}]}`),
+	)
+	z.Must(err)
+	t.Cleanup(func() { cc.Close() })
+	return messagepb.NewVersatileClient(cc)
+}
+
+func count(t *testing.T, cli messagepb.VersatileClient, n int) map[string]int {
+	cnt := map[string]int{}
+	for range n {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+		resp, err := cli.Any(ctx, &messagepb.Request{}, grpc.WaitForReady(true))
+		cancel()
+		z.Must(err)
+		cnt[resp.Message]++
+	}
+	return cnt
+}
+
+func TestWeightRoundRobin(t *testing.T) {
+	a := startServer(t, map[string]string{"weight": "3"})
+	b := startServer(t, map[string]string{"weight": "1"})
+	reg := &fakeRegistry{insts: []nacs.Instance{a, b}}
+	cli := dial(t, reg, WeightRoundRobin)
+
+	// wait until both SubConns are ready
+	assert.Eventually(t, func() bool { return len(count(t, cli, 8)) == 2 }, time.Second*3, time.Millisecond*10)
+	cnt := count(t, cli, 400)
+	assert.InDelta(t, 300, cnt[a.Addr()], 4)
+	assert.InDelta(t, 100, cnt[b.Addr()], 4)
+
+	// removed instances get no more traffic
+	reg.set([]nacs.Instance{b})
+	assert.Eventually(t, func() bool { return count(t, cli, 20)[b.Addr()] == 20 }, time.Second*3, time.Millisecond*10)
+}
+
+func TestStrategies(t *testing.T) {
+	a := startServer(t, nil)
+	b := startServer(t, nil)
+
+	for _, lb := range []string{RoundRobin, Random, Failover} {
+		reg := &fakeRegistry{insts: []nacs.Instance{a, b}}
+		cli := dial(t, reg, lb)
+		cnt := count(t, cli, 40)
+		assert.Equal(t, 40, cnt[a.Addr()]+cnt[b.Addr()], lb)
+	}
+}
+
+func TestInstanceOf(t *testing.T) {
+	inst := nacs.Instance{Service: "echo", Host: "127.0.0.1", Port: 80, Meta: map[string]string{"zone": "a"}}
+	cc := &fakeClientConn{}
+	r, err := NewRegistryBuilder("nacs-test", &fakeRegistry{insts: []nacs.Instance{inst}}).
+		Build(resolver.Target{}, cc, resolver.BuildOptions{})
+	z.Must(err)
+	defer r.Close()
+
+	assert.Len(t, cc.state.Addresses, 1)
+	got, ok := InstanceOf(cc.state.Addresses[0])
+	assert.True(t, ok)
+	assert.Equal(t, inst, got)
+	assert.Equal(t, inst.Meta, MetaOf(cc.state.Addresses[0]))
+	assert.True(t, cc.state.Addresses[0].Equal(resolver.Address{Addr: inst.Addr(), Attributes: cc.state.Addresses[0].Attributes}))
+
+	_, ok = InstanceOf(resolver.Address{Addr: inst.Addr()})
+	assert.False(t, ok)
+}
+
+type fakeClientConn struct {
+	resolver.ClientConn
+	state resolver.State
+}
+
+func (cc *fakeClientConn) UpdateState(s resolver.State) error {
+	cc.state = s
+	return nil
+}
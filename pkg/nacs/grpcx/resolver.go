@@ -0,0 +1,147 @@
+package grpcx
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/cocktail828/go-tools/pkg/nacs"
+	_ "github.com/cocktail828/go-tools/pkg/nacs/etcd"
+	_ "github.com/cocktail828/go-tools/pkg/nacs/nacos"
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/resolver"
+)
+
+func init() {
+	resolver.Register(NewBuilder("etcd"))
+	resolver.Register(NewBuilder("nacos"))
+}
+
+type instanceKey struct{}
+
+// instanceAttr carries the instance in the address attributes,
+// attribute values must be comparable or implement Equal.
+type instanceAttr struct{ nacs.Instance }
+
+func (a instanceAttr) Equal(o any) bool {
+	other, ok := o.(instanceAttr)
+	return ok && reflect.DeepEqual(a.Instance, other.Instance)
+}
+
+// InstanceOf returns the instance which the address is resolved from
+func InstanceOf(addr resolver.Address) (nacs.Instance, bool) {
+	attr, ok := addr.Attributes.Value(instanceKey{}).(instanceAttr)
+	return attr.Instance, ok
+}
+
+// MetaOf returns the metadata of the instance which the address is resolved from
+func MetaOf(addr resolver.Address) map[string]string {
+	inst, _ := InstanceOf(addr)
+	return inst.Meta
+}
+
+type builder struct {
+	scheme   string
+	registry nacs.Registry // fixed registry, nil means opening one per target
+}
+
+// NewBuilder creates a resolver builder for the scheme, the target is opened by nacs.Open, e.g.
+//
+//	etcd://127.0.0.1:2379?namespace=myns&service=myservice&version=v1.0.0
+//
+// The nacs driver of the scheme must be registered in advance.
+func NewBuilder(scheme string) resolver.Builder {
+	return &builder{scheme: scheme}
+}
+
+// NewRegistryBuilder creates a resolver builder which resolves every target of the scheme from the registry.
+// The registry is shared by all targets and never closed by the resolvers.
+func NewRegistryBuilder(scheme string, registry nacs.Registry) resolver.Builder {
+	return &builder{scheme: scheme, registry: registry}
+}
+
+func (b *builder) Scheme() string { return b.scheme }
+
+func (b *builder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	r := &nacsResolver{
+		cc:       cc,
+		registry: b.registry,
+		set:      map[string]nacs.Instance{},
+	}
+
+	if r.registry == nil {
+		u := target.URL
+		registry, err := nacs.Open(&u)
+		if err != nil {
+			return nil, err
+		}
+		r.registry = registry
+		r.owned = true
+	}
+
+	cancel, err := r.registry.WatchEvents(r.onEvents)
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.cancel = cancel
+	r.mu.Unlock()
+	return r, nil
+}
+
+// nacsResolver turns the instance events of a registry into gRPC address updates
+type nacsResolver struct {
+	cc       resolver.ClientConn
+	registry nacs.Registry
+	owned    bool // whether the registry is opened by the resolver
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	set    map[string]nacs.Instance
+	closed bool
+}
+
+func (r *nacsResolver) onEvents(evs []nacs.Event, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+
+	if err != nil {
+		r.cc.ReportError(err)
+		return
+	}
+
+	nacs.Apply(r.set, evs)
+	insts := nacs.Instances(r.set)
+	addrs := make([]resolver.Address, 0, len(insts))
+	for _, inst := range insts {
+		addrs = append(addrs, resolver.Address{
+			Addr:       inst.Addr(),
+			Attributes: attributes.New(instanceKey{}, instanceAttr{inst}),
+		})
+	}
+	r.cc.UpdateState(resolver.State{Addresses: addrs})
+}
+
+// ResolveNow is a no-op, the addresses are pushed by the registry watch
+func (r *nacsResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+func (r *nacsResolver) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	r.closed = true
+
+	if r.cancel != nil {
+		r.cancel()
+	}
+	if r.owned {
+		r.registry.Close()
+	}
+}
@@ -0,0 +1,269 @@
+package nacs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+var _ Configor = &LayeredConfigor{}
+
+// Layer is a config source of LayeredConfigor
+type Layer struct {
+	Name     string   // name reported as the source of the keys
+	Configor Configor // the source
+	Format   Format   // format of the payload, HCL can not be merged
+	Optional bool     // a failed load is treated as an empty layer
+}
+
+// LayeredConfigor stacks several configors, later layers take precedence over earlier ones.
+// Objects are merged deeply, any other value (arrays included) of a higher layer replaces the lower one.
+// The merged payload is encoded in the output format.
+type LayeredConfigor struct {
+	format Format
+	layers []Layer
+
+	mu      sync.RWMutex
+	sources map[string]string // dotted key path -> layer name
+}
+
+// NewLayeredConfigor creates a composite configor, layers are given from the lowest to the highest precedence
+func NewLayeredConfigor(format Format, layers ...Layer) (*LayeredConfigor, error) {
+	if format == FormatHCL {
+		return nil, errors.New("nacs: hcl can not be merged")
+	}
+	if _, err := format.Unmarshaller(); err != nil {
+		return nil, err
+	}
+	if len(layers) == 0 {
+		return nil, errors.New("nacs: no layer")
+	}
+
+	for i, l := range layers {
+		if l.Configor == nil {
+			return nil, errors.Errorf("nacs: layer %d has no configor", i)
+		}
+		if l.Format == FormatHCL {
+			return nil, errors.Errorf("nacs: layer %q is hcl which can not be merged", l.Name)
+		}
+		if _, err := l.Format.Unmarshaller(); err != nil {
+			return nil, err
+		}
+	}
+	return &LayeredConfigor{format: format, layers: layers, sources: map[string]string{}}, nil
+}
+
+// DataID returns the names of the layers joined by '+'
+func (c *LayeredConfigor) DataID() string {
+	names := make([]string, 0, len(c.layers))
+	for _, l := range c.layers {
+		names = append(names, l.Name)
+	}
+	return strings.Join(names, "+")
+}
+
+// Source returns the name of the layer which supplies the key, the key is a dotted path such as 'db.host'
+func (c *LayeredConfigor) Source(key string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	name, ok := c.sources[key]
+	return name, ok
+}
+
+// Sources returns the layer names of all leaf keys of the last merged config
+func (c *LayeredConfigor) Sources() map[string]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	res := make(map[string]string, len(c.sources))
+	for k, v := range c.sources {
+		res[k] = v
+	}
+	return res
+}
+
+func (c *LayeredConfigor) decode(i int, info ConfigInfo) (map[string]any, error) {
+	l := c.layers[i]
+	val := map[string]any{}
+	if len(bytes.TrimSpace(info.Payload)) == 0 {
+		return val, nil
+	}
+
+	unmarshal, _ := l.Format.Unmarshaller()
+	if err := unmarshal(info.Payload, &val); err != nil {
+		return nil, errors.Wrapf(err, "nacs: decode layer %q fail", l.Name)
+	}
+	return val, nil
+}
+
+func (c *LayeredConfigor) load(ctx context.Context, i int) (map[string]any, error) {
+	info, err := c.layers[i].Configor.Load(ctx)
+	if err != nil {
+		if c.layers[i].Optional {
+			return map[string]any{}, nil
+		}
+		return nil, errors.Wrapf(err, "nacs: load layer %q fail", c.layers[i].Name)
+	}
+	return c.decode(i, info)
+}
+
+func (c *LayeredConfigor) merge(values []map[string]any) (ConfigInfo, error) {
+	merged := map[string]any{}
+	sources := map[string]string{}
+	for i, val := range values {
+		mergeInto(merged, val, "", c.layers[i].Name, sources)
+	}
+
+	var payload []byte
+	var err error
+	switch c.format {
+	case FormatJSON:
+		payload, err = json.Marshal(merged)
+	case FormatYAML:
+		payload, err = yaml.Marshal(merged)
+	case FormatTOML:
+		buf := &bytes.Buffer{}
+		err = toml.NewEncoder(buf).Encode(merged)
+		payload = buf.Bytes()
+	}
+	if err != nil {
+		return ConfigInfo{}, errors.Wrap(err, "nacs: encode merged config fail")
+	}
+
+	c.mu.Lock()
+	c.sources = sources
+	c.mu.Unlock()
+	return ConfigInfo{DataID: c.DataID(), Payload: payload}, nil
+}
+
+// mergeInto merges src into dst deeply and records the leaf keys supplied by the layer
+func mergeInto(dst, src map[string]any, prefix, layer string, sources map[string]string) {
+	keys := make([]string, 0, len(src))
+	for k := range src {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		path := prefix + k
+		v := src[k]
+		sm, srcIsMap := v.(map[string]any)
+		dm, dstIsMap := dst[k].(map[string]any)
+		if srcIsMap && dstIsMap {
+			mergeInto(dm, sm, path+".", layer, sources)
+			continue
+		}
+
+		// the lower value is replaced entirely
+		for key := range sources {
+			if key == path || strings.HasPrefix(key, path+".") {
+				delete(sources, key)
+			}
+		}
+		if srcIsMap {
+			m := map[string]any{}
+			mergeInto(m, sm, path+".", layer, sources)
+			if len(sm) == 0 {
+				sources[path] = layer
+			}
+			dst[k] = m
+		} else {
+			dst[k] = v
+			sources[path] = layer
+		}
+	}
+}
+
+// Load loads all layers and merges them
+func (c *LayeredConfigor) Load(ctx context.Context) (ConfigInfo, error) {
+	values := make([]map[string]any, len(c.layers))
+	for i := range c.layers {
+		val, err := c.load(ctx, i)
+		if err != nil {
+			return ConfigInfo{}, err
+		}
+		values[i] = val
+	}
+	return c.merge(values)
+}
+
+// Monitor monitors all layers, the merged config is delivered whenever it changes.
+// A layer which fails to load or decode is reported and its last good value is kept.
+func (c *LayeredConfigor) Monitor(cb func(ConfigInfo, error)) (context.CancelFunc, error) {
+	if cb == nil {
+		return nil, errors.New("callback is nil")
+	}
+
+	var mu sync.Mutex
+	values := make([]map[string]any, len(c.layers))
+	for i := range c.layers {
+		val, err := c.load(context.Background(), i)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = val
+	}
+	info, err := c.merge(values)
+	if err != nil {
+		return nil, err
+	}
+	last := info.Payload
+
+	cancels := make([]context.CancelFunc, 0, len(c.layers))
+	cancelAll := func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}
+	for i, l := range c.layers {
+		cancel, err := l.Configor.Monitor(func(info ConfigInfo, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				cb(ConfigInfo{DataID: c.DataID()}, errors.Wrapf(err, "nacs: layer %q fail", l.Name))
+				return
+			}
+			val, err := c.decode(i, info)
+			if err != nil {
+				cb(ConfigInfo{DataID: c.DataID()}, err)
+				return
+			}
+
+			values[i] = val
+			merged, err := c.merge(values)
+			if err != nil {
+				cb(merged, err)
+				return
+			}
+			if bytes.Equal(last, merged.Payload) {
+				return
+			}
+			last = merged.Payload
+			cb(merged, nil)
+		})
+		if err != nil {
+			cancelAll()
+			return nil, errors.Wrapf(err, "nacs: monitor layer %q fail", l.Name)
+		}
+		cancels = append(cancels, cancel)
+	}
+	return cancelAll, nil
+}
+
+// Close closes all layers, the first error is returned
+func (c *LayeredConfigor) Close() error {
+	var firstErr error
+	for _, l := range c.layers {
+		if err := l.Configor.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,110 @@
+package nacs_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/cocktail828/go-tools/pkg/nacs"
+	"github.com/cocktail828/go-tools/pkg/nacs/static"
+	"github.com/cocktail828/go-tools/z"
+	"github.com/stretchr/testify/assert"
+)
+
+type failConfigor struct{ pushConfigor }
+
+func (c *failConfigor) Load(ctx context.Context) (nacs.ConfigInfo, error) {
+	return nacs.ConfigInfo{}, errors.New("not found")
+}
+
+func decodeJSON(t *testing.T, info nacs.ConfigInfo) map[string]any {
+	val := map[string]any{}
+	z.Must(json.Unmarshal(info.Payload, &val))
+	return val
+}
+
+func TestLayeredConfigor(t *testing.T) {
+	defaults := static.NewStaticConfigor([]byte("name = \"app\"\ntags = [\"a\", \"b\"]\n[db]\nhost = \"localhost\"\nport = 3306\n"))
+	overrides := &pushConfigor{payload: []byte("db:\n  host: db.example.com\n")}
+	emergency := &failConfigor{}
+
+	c, err := nacs.NewLayeredConfigor(nacs.FormatJSON,
+		nacs.Layer{Name: "file", Configor: defaults, Format: nacs.FormatTOML},
+		nacs.Layer{Name: "etcd", Configor: overrides, Format: nacs.FormatYAML},
+		nacs.Layer{Name: "nacos", Configor: emergency, Format: nacs.FormatJSON, Optional: true},
+	)
+	z.Must(err)
+	defer c.Close()
+
+	info, err := c.Load(context.Background())
+	z.Must(err)
+	assert.Equal(t, "file+etcd+nacos", info.DataID)
+	assert.Equal(t, map[string]any{
+		"name": "app",
+		"tags": []any{"a", "b"},
+		"db":   map[string]any{"host": "db.example.com", "port": float64(3306)},
+	}, decodeJSON(t, info))
+	assert.Equal(t, map[string]string{"name": "file", "tags": "file", "db.host": "etcd", "db.port": "file"}, c.Sources())
+
+	var infos []nacs.ConfigInfo
+	var errs []error
+	cancel, err := c.Monitor(func(info nacs.ConfigInfo, err error) {
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		infos = append(infos, info)
+	})
+	z.Must(err)
+	defer cancel()
+
+	// the highest layer wins, a scalar replaces the whole object
+	emergency.push(`{"db": "sqlite://memory", "tags": ["c"]}`)
+	assert.Len(t, infos, 1)
+	assert.Equal(t, map[string]any{"name": "app", "tags": []any{"c"}, "db": "sqlite://memory"}, decodeJSON(t, infos[0]))
+	src, ok := c.Source("db")
+	assert.True(t, ok)
+	assert.Equal(t, "nacos", src)
+	_, ok = c.Source("db.host")
+	assert.False(t, ok)
+
+	// changes hidden by a higher layer are not delivered
+	overrides.push("db:\n  host: other.example.com\n")
+	assert.Len(t, infos, 1)
+
+	// broken layers keep their last good value
+	emergency.push(`{"db": `)
+	assert.Len(t, errs, 1)
+	emergency.push(`{}`)
+	assert.Len(t, infos, 2)
+	assert.Equal(t, "other.example.com", decodeJSON(t, infos[1])["db"].(map[string]any)["host"])
+}
+
+func TestNewLayeredConfigor(t *testing.T) {
+	_, err := nacs.NewLayeredConfigor(nacs.FormatHCL, nacs.Layer{Configor: &pushConfigor{}, Format: nacs.FormatJSON})
+	assert.Error(t, err)
+	_, err = nacs.NewLayeredConfigor(nacs.FormatJSON)
+	assert.Error(t, err)
+	_, err = nacs.NewLayeredConfigor(nacs.FormatJSON, nacs.Layer{Configor: &pushConfigor{}, Format: nacs.FormatHCL})
+	assert.Error(t, err)
+
+	// required layers must load
+	c, err := nacs.NewLayeredConfigor(nacs.FormatYAML, nacs.Layer{Name: "nacos", Configor: &failConfigor{}, Format: nacs.FormatJSON})
+	z.Must(err)
+	_, err = c.Load(context.Background())
+	assert.Error(t, err)
+	_, err = c.Monitor(func(nacs.ConfigInfo, error) {})
+	assert.Error(t, err)
+
+	// the merged config can be bound
+	c, err = nacs.NewLayeredConfigor(nacs.FormatYAML,
+		nacs.Layer{Name: "a", Configor: static.NewStaticConfigor([]byte(`{"name": "app", "port": 1}`)), Format: nacs.FormatJSON},
+		nacs.Layer{Name: "b", Configor: static.NewStaticConfigor([]byte(`port = 2`)), Format: nacs.FormatTOML},
+	)
+	z.Must(err)
+	b, err := nacs.Bind[appConfig](c, nacs.FormatYAML)
+	z.Must(err)
+	defer b.Close()
+	assert.Equal(t, 2, b.Get().Port)
+}
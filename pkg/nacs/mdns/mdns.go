@@ -0,0 +1,288 @@
+package mdns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cocktail828/go-tools/pkg/nacs"
+	mdnsx "github.com/cocktail828/go-tools/pkg/netx/mdns"
+	"github.com/pkg/errors"
+)
+
+var _ nacs.Registry = &MDNSClient{}
+
+func init() {
+	nacs.RegisterRegistry("mdns", func(u *url.URL) (nacs.Registry, error) {
+		c, err := NewMDNSClient(u)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	})
+}
+
+const (
+	// reserved TXT record keys
+	txtNamespace = "nacs_namespace"
+	txtVersion   = "nacs_version"
+)
+
+// MDNSClient is a registry for LAN deployments without any registry server.
+// Instances are announced via multicast DNS as '_$service._tcp.$domain' and carry
+// namespace, version and metadata as TXT records.
+type MDNSClient struct {
+	namespace string
+	service   string
+	version   string
+	domain    string
+	iface     *net.Interface
+	timeout   time.Duration // lookup timeout
+	interval  time.Duration // watch polling interval
+
+	mu        sync.Mutex
+	announced map[string]func() error // instance name -> shutdown
+}
+
+// mdns://[$iface]?namespace=$namespace&service=$service&version=$version&domain=local.&timeout=1s&interval=5s
+func NewMDNSClient(u *url.URL) (*MDNSClient, error) {
+	query := u.Query()
+	c := &MDNSClient{
+		namespace: query.Get("namespace"),
+		service:   query.Get("service"),
+		version:   query.Get("version"),
+		domain:    query.Get("domain"),
+		timeout:   time.Second,
+		interval:  time.Second * 5,
+		announced: map[string]func() error{},
+	}
+
+	if c.namespace == "" {
+		return nil, errors.New("namespace is empty")
+	}
+	if c.service == "" {
+		return nil, errors.New("service is empty")
+	}
+	if c.version == "" {
+		return nil, errors.New("version is empty")
+	}
+
+	if u.Host != "" {
+		iface, err := net.InterfaceByName(u.Host)
+		if err != nil {
+			return nil, errors.Wrapf(err, "mdns: invalid interface %q", u.Host)
+		}
+		c.iface = iface
+	}
+
+	if str := query.Get("timeout"); str != "" {
+		if val, err := time.ParseDuration(str); err == nil && val > 0 {
+			c.timeout = val
+		}
+	}
+
+	if str := query.Get("interval"); str != "" {
+		if val, err := time.ParseDuration(str); err == nil && val > 0 {
+			c.interval = val
+		}
+	}
+
+	return c, nil
+}
+
+// ServiceName returns the service name in mdns format: _$service._tcp
+func (c *MDNSClient) ServiceName() string { return "_" + c.service + "._tcp" }
+
+// InstanceName returns the instance name in mdns format: $host-$port, dots and colons are replaced by dashes
+// It is used to identify the service instance in mdns.
+func (c *MDNSClient) InstanceName(host string, port uint) string {
+	return fmt.Sprintf("%s-%d", strings.NewReplacer(".", "-", ":", "-").Replace(host), port)
+}
+
+func (c *MDNSClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, shutdown := range c.announced {
+		shutdown()
+		delete(c.announced, name)
+	}
+	return nil
+}
+
+func (c *MDNSClient) Register(ctx context.Context, inst nacs.Instance) (context.CancelFunc, error) {
+	txt := []string{txtNamespace + "=" + c.namespace, txtVersion + "=" + c.version}
+	for k, v := range inst.Meta {
+		txt = append(txt, k+"="+v)
+	}
+	sort.Strings(txt[2:])
+
+	param := mdnsx.Instance{
+		Iface:   c.iface,
+		Name:    c.InstanceName(inst.Host, inst.Port),
+		Service: c.ServiceName(),
+		Domain:  c.domain,
+		Port:    int(inst.Port),
+		Info:    txt,
+	}
+	if ip := net.ParseIP(inst.Host); ip != nil {
+		param.IPs = []net.IP{ip}
+	} else {
+		param.HostName = strings.TrimSuffix(inst.Host, ".") + "."
+	}
+
+	shutdown, err := mdnsx.Serve(param)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if old, ok := c.announced[param.Name]; ok {
+		old()
+	}
+	c.announced[param.Name] = shutdown
+	c.mu.Unlock()
+
+	return func() { c.DeRegister(context.Background(), inst) }, nil
+}
+
+func (c *MDNSClient) DeRegister(ctx context.Context, inst nacs.Instance) error {
+	name := c.InstanceName(inst.Host, inst.Port)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if shutdown, ok := c.announced[name]; ok {
+		delete(c.announced, name)
+		return shutdown()
+	}
+	return nil
+}
+
+func (c *MDNSClient) toInstance(entry mdnsx.Entry) (nacs.Instance, bool) {
+	var meta map[string]string
+	var namespace, version string
+	for _, field := range entry.Info {
+		k, v, _ := strings.Cut(field, "=")
+		switch k {
+		case txtNamespace:
+			namespace = v
+		case txtVersion:
+			version = v
+		default:
+			if meta == nil {
+				meta = map[string]string{}
+			}
+			meta[k] = v
+		}
+	}
+
+	if namespace != c.namespace || version != c.version {
+		return nacs.Instance{}, false
+	}
+
+	var host string
+	switch {
+	case entry.AddrV4 != nil:
+		host = entry.AddrV4.String()
+	case entry.AddrV6 != nil:
+		host = entry.AddrV6.IP.String()
+	default:
+		return nacs.Instance{}, false
+	}
+
+	return nacs.Instance{
+		Service: c.service,
+		Version: version,
+		Host:    host,
+		Port:    uint(entry.Port),
+		Meta:    meta,
+	}, true
+}
+
+func (c *MDNSClient) Discover(ctx context.Context) ([]nacs.Instance, error) {
+	timeout := c.timeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = min(timeout, time.Until(deadline))
+	}
+
+	entries, err := mdnsx.Lookup(mdnsx.LookParam{
+		Service:   c.ServiceName(),
+		Domain:    strings.TrimSuffix(c.domain, "."),
+		Timeout:   timeout,
+		Interface: c.iface,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// an instance may answer several times, e.g. on different interfaces
+	seen := map[string]struct{}{}
+	res := make([]nacs.Instance, 0, len(entries))
+	for _, entry := range entries {
+		inst, ok := c.toInstance(entry)
+		if !ok {
+			continue
+		}
+
+		if _, ok := seen[inst.Addr()]; ok {
+			continue
+		}
+		seen[inst.Addr()] = struct{}{}
+		res = append(res, inst)
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Addr() < res[j].Addr() })
+	return res, nil
+}
+
+// Watch polls the LAN every interval, the callback is invoked when instances change
+func (c *MDNSClient) Watch(callback func([]nacs.Instance, error)) (context.CancelFunc, error) {
+	if callback == nil {
+		return nil, errors.New("callback is nil")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		var last []nacs.Instance
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			instances, err := c.Discover(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				callback(nil, err)
+				continue
+			}
+
+			if last != nil && reflect.DeepEqual(last, instances) {
+				continue
+			}
+			last = instances
+			callback(instances, nil)
+		}
+	}()
+
+	return cancel, nil
+}
+
+// WatchEvents diffs the instance lists delivered by Watch into incremental events
+func (c *MDNSClient) WatchEvents(callback func([]nacs.Event, error)) (context.CancelFunc, error) {
+	if callback == nil {
+		return nil, errors.New("callback is nil")
+	}
+	return nacs.WatchDiff(c, callback)
+}
@@ -0,0 +1,63 @@
+package mdns
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/cocktail828/go-tools/pkg/nacs"
+	"github.com/cocktail828/go-tools/z"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewMDNSClient(t *testing.T) {
+	for _, uri := range []string{
+		"mdns://?service=asfd&version=v1.0.0",
+		"mdns://?namespace=myns&version=v1.0.0",
+		"mdns://?namespace=myns&service=asfd",
+		"mdns://no-such-iface?namespace=myns&service=asfd&version=v1.0.0",
+	} {
+		u, err := url.Parse(uri)
+		z.Must(err)
+		_, err = NewMDNSClient(u)
+		assert.Error(t, err, uri)
+	}
+}
+
+func TestNaming(t *testing.T) {
+	u, err := url.Parse("mdns://?namespace=myns&service=asfd&version=v1.0.0&timeout=500ms&interval=100ms")
+	z.Must(err)
+	ncs, err := NewMDNSClient(u)
+	z.Must(err)
+	defer ncs.Close()
+
+	u, err = url.Parse("mdns://?namespace=otherns&service=asfd&version=v1.0.0&timeout=500ms")
+	z.Must(err)
+	other, err := NewMDNSClient(u)
+	z.Must(err)
+	defer other.Close()
+
+	instance := nacs.Instance{
+		Service: "asfd",
+		Version: "v1.0.0",
+		Host:    "127.0.0.1",
+		Port:    8080,
+		Meta:    map[string]string{"a": "b"},
+	}
+	deregister, err := ncs.Register(context.Background(), instance)
+	z.Must(err)
+	defer deregister()
+
+	// instances of other namespaces are announced as well but must be invisible
+	_, err = other.Register(context.Background(), nacs.Instance{Host: "127.0.0.1", Port: 8081})
+	z.Must(err)
+
+	insts, err := ncs.Discover(context.Background())
+	z.Must(err)
+	assert.Equal(t, []nacs.Instance{instance}, insts)
+
+	z.Must(ncs.DeRegister(context.Background(), instance))
+	insts, err = ncs.Discover(context.Background())
+	z.Must(err)
+	assert.Empty(t, insts)
+}
@@ -0,0 +1,218 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/cocktail828/go-tools/pkg/nacs"
+	"github.com/pkg/errors"
+)
+
+var _ nacs.Registry = &MemoryClient{}
+
+func init() {
+	nacs.RegisterRegistry("memory", func(u *url.URL) (nacs.Registry, error) {
+		c, err := NewMemoryClient(u)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	})
+}
+
+// memory URI format: memory://$name?namespace=$namespace&service=$service&version=$version&ttl=10
+type MemoryClient struct {
+	namespace string
+	service   string
+	version   string
+	ttl       time.Duration
+	store     *Store
+	ctx       context.Context
+	cancel    context.CancelFunc
+}
+
+// NewMemoryClient creates a client on the shared store named by the URL host.
+// The URL query should contain namespace, service, version, the optional 'ttl' is
+// the lease ttl in seconds or a duration such as '500ms'.
+func NewMemoryClient(u *url.URL) (*MemoryClient, error) {
+	query := u.Query()
+	c, err := Shared(u.Host).Spawn(query.Get("namespace"), query.Get("service"), query.Get("version"))
+	if err != nil {
+		return nil, err
+	}
+
+	if str := query.Get("ttl"); str != "" {
+		if val, err := strconv.ParseInt(str, 10, 64); err == nil && val > 0 {
+			c.ttl = time.Duration(val) * time.Second
+		} else if val, err := time.ParseDuration(str); err == nil && val > 0 {
+			c.ttl = val
+		}
+	}
+	return c, nil
+}
+
+func newMemoryClient(s *Store, namespace, service, version string) (*MemoryClient, error) {
+	if namespace == "" {
+		return nil, errors.New("namespace is empty")
+	}
+	if service == "" {
+		return nil, errors.New("service is empty")
+	}
+	if version == "" {
+		return nil, errors.New("version is empty")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &MemoryClient{
+		namespace: namespace,
+		service:   service,
+		version:   version,
+		ttl:       time.Second * 10,
+		store:     s,
+		ctx:       ctx,
+		cancel:    cancel,
+	}, nil
+}
+
+func (c *MemoryClient) Prefix() string {
+	return fmt.Sprintf("%s/%s@%s", c.namespace, c.service, c.version)
+}
+
+// ServiceKey returns the service key in etcd format: $namespace/$service@$version/instances/$host:$port
+// It is used to identify the service instance in the store.
+func (c *MemoryClient) ServiceKey(host string, port uint) string {
+	return fmt.Sprintf("%s/instances/%s:%d", c.Prefix(), host, port)
+}
+
+// Store returns the underlying store, faults are injected there
+func (c *MemoryClient) Store() *Store { return c.store }
+
+// Share creates a new client with different namespace, service, version on the same store
+func (c *MemoryClient) Share(namespace, service, version string) (*MemoryClient, error) {
+	nc, err := c.store.Spawn(namespace, service, version)
+	if err != nil {
+		return nil, err
+	}
+	nc.ttl = c.ttl
+	return nc, nil
+}
+
+// Close stops the watches and the lease renewals of the client,
+// the registered instances expire after ttl just like a crashed process.
+func (c *MemoryClient) Close() error {
+	c.cancel()
+	return nil
+}
+
+func (c *MemoryClient) Register(ctx context.Context, inst nacs.Instance) (context.CancelFunc, error) {
+	if c.ctx.Err() != nil {
+		return nil, errors.New("client is closed")
+	}
+	key := c.ServiceKey(inst.Host, inst.Port)
+	drop, err := c.store.inject(ctx, OpRegister)
+	if err != nil {
+		return nil, err
+	}
+	if drop {
+		return func() {}, nil
+	}
+
+	lease := c.store.put(key, inst, c.ttl)
+	cancelCtx, cancel := context.WithCancel(c.ctx)
+	go func() {
+		ticker := time.NewTicker(c.ttl / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-cancelCtx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if drop, err := c.store.inject(cancelCtx, OpKeepalive); drop || err != nil {
+				continue
+			}
+			if !c.store.renew(key, lease, c.ttl) {
+				// the lease has expired or the instance is registered again
+				return
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		c.store.delete(key, lease)
+	}, nil
+}
+
+func (c *MemoryClient) DeRegister(ctx context.Context, inst nacs.Instance) error {
+	drop, err := c.store.inject(ctx, OpDeRegister)
+	if err != nil || drop {
+		return err
+	}
+	c.store.delete(c.ServiceKey(inst.Host, inst.Port), 0)
+	return nil
+}
+
+func (c *MemoryClient) Discover(ctx context.Context) ([]nacs.Instance, error) {
+	drop, err := c.store.inject(ctx, OpDiscover)
+	if err != nil {
+		return nil, err
+	}
+	if drop {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+	return nacs.Instances(c.store.list(c.Prefix() + "/instances/")), nil
+}
+
+func (c *MemoryClient) Watch(callback func([]nacs.Instance, error)) (context.CancelFunc, error) {
+	if callback == nil {
+		return nil, errors.New("callback is nil")
+	}
+
+	set := map[string]nacs.Instance{}
+	synced := false
+	return c.WatchEvents(func(evs []nacs.Event, err error) {
+		if err != nil {
+			callback(nil, err)
+			return
+		}
+
+		nacs.Apply(set, evs)
+		// the initial instances are not a change
+		if !synced {
+			synced = true
+			return
+		}
+		callback(nacs.Instances(set), nil)
+	})
+}
+
+// WatchEvents delivers the changes in revision order, the store never blocks on a slow callback.
+// A watcher which misses events because of an injected OpWatch fault catches up with the difference once healed.
+func (c *MemoryClient) WatchEvents(callback func([]nacs.Event, error)) (context.CancelFunc, error) {
+	if callback == nil {
+		return nil, errors.New("callback is nil")
+	}
+	if c.ctx.Err() != nil {
+		return nil, errors.New("client is closed")
+	}
+
+	w, evs := c.store.watch(c.Prefix()+"/instances/", callback)
+	callback(evs, nil)
+	go w.loop()
+
+	stop := context.AfterFunc(c.ctx, func() { c.store.unwatch(w) })
+	return func() {
+		stop()
+		c.store.unwatch(w)
+	}, nil
+}
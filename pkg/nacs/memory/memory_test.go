@@ -0,0 +1,228 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/cocktail828/go-tools/pkg/nacs"
+	"github.com/cocktail828/go-tools/z"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestClient(t *testing.T, s *Store) *MemoryClient {
+	c, err := s.Spawn("myns", "asfd", "v1.0.0")
+	z.Must(err)
+	c.ttl = time.Millisecond * 300
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// collect gathers the events delivered after the initial batch
+func collect(t *testing.T, c *MemoryClient) (initial []nacs.Event, ch chan []nacs.Event, errs chan error) {
+	ch = make(chan []nacs.Event, 16)
+	errs = make(chan error, 16)
+	first := true
+	cancel, err := c.WatchEvents(func(evs []nacs.Event, err error) {
+		if err != nil {
+			errs <- err
+			return
+		}
+		if first {
+			first = false
+			initial = evs
+			return
+		}
+		ch <- evs
+	})
+	z.Must(err)
+	t.Cleanup(cancel)
+	return initial, ch, errs
+}
+
+func recv[T any](t *testing.T, ch chan T) T {
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(time.Second * 3):
+		t.Fatal("timeout")
+		panic("unreachable")
+	}
+}
+
+func TestNewMemoryClient(t *testing.T) {
+	for _, uri := range []string{
+		"memory://test?service=asfd&version=v1.0.0",
+		"memory://test?namespace=myns&version=v1.0.0",
+		"memory://test?namespace=myns&service=asfd",
+	} {
+		u, err := url.Parse(uri)
+		z.Must(err)
+		_, err = NewMemoryClient(u)
+		assert.Error(t, err, uri)
+	}
+
+	u, err := url.Parse("memory://test?namespace=myns&service=asfd&version=v1.0.0&ttl=500ms")
+	z.Must(err)
+	c, err := NewMemoryClient(u)
+	z.Must(err)
+	defer c.Close()
+	assert.Equal(t, time.Millisecond*500, c.ttl)
+	assert.Equal(t, Shared("test"), c.Store())
+	assert.Equal(t, "myns/asfd@v1.0.0/instances/127.0.0.1:8080", c.ServiceKey("127.0.0.1", 8080))
+
+	// clients opened by the same name share the instances
+	u, err = url.Parse("memory://test?namespace=myns&service=asfd&version=v1.0.0&ttl=1")
+	z.Must(err)
+	r, err := nacs.Open(u)
+	z.Must(err)
+	defer r.Close()
+	_, err = c.Register(context.Background(), nacs.Instance{Host: "127.0.0.1", Port: 8080})
+	z.Must(err)
+	insts, err := r.Discover(context.Background())
+	z.Must(err)
+	assert.Len(t, insts, 1)
+}
+
+func TestNaming(t *testing.T) {
+	s := NewStore()
+	c := newTestClient(t, s)
+	other, err := c.Share("myns", "asfd", "v2.0.0")
+	z.Must(err)
+	defer other.Close()
+
+	a := nacs.Instance{Service: "asfd", Version: "v1.0.0", Host: "127.0.0.1", Port: 8080, Meta: map[string]string{"a": "b"}}
+	b := nacs.Instance{Service: "asfd", Version: "v1.0.0", Host: "127.0.0.1", Port: 8081}
+
+	_, err = c.Register(context.Background(), a)
+	z.Must(err)
+	initial, ch, _ := collect(t, c)
+	assert.Equal(t, []nacs.Event{{Type: nacs.EventAdded, Instance: a, Revision: 1}}, initial)
+
+	// watchers of other versions see nothing
+	_, otherCh, _ := collect(t, other)
+	deregister, err := c.Register(context.Background(), b)
+	z.Must(err)
+	assert.Equal(t, []nacs.Event{{Type: nacs.EventAdded, Instance: b, Revision: 2}}, recv(t, ch))
+
+	a.Meta = map[string]string{"a": "c"}
+	_, err = c.Register(context.Background(), a)
+	z.Must(err)
+	assert.Equal(t, []nacs.Event{{Type: nacs.EventUpdated, Instance: a, Revision: 3}}, recv(t, ch))
+
+	deregister()
+	assert.Equal(t, []nacs.Event{{Type: nacs.EventRemoved, Instance: b, Revision: 4}}, recv(t, ch))
+
+	insts, err := c.Discover(context.Background())
+	z.Must(err)
+	assert.Equal(t, []nacs.Instance{a}, insts)
+	insts, err = other.Discover(context.Background())
+	z.Must(err)
+	assert.Empty(t, insts)
+	assert.Empty(t, otherCh)
+
+	z.Must(c.DeRegister(context.Background(), a))
+	assert.Equal(t, []nacs.Event{{Type: nacs.EventRemoved, Instance: a, Revision: 5}}, recv(t, ch))
+}
+
+func TestWatchFanOut(t *testing.T) {
+	c := newTestClient(t, NewStore())
+
+	lists := make(chan []nacs.Instance, 16)
+	cancel, err := c.Watch(func(insts []nacs.Instance, err error) {
+		z.Must(err)
+		lists <- insts
+	})
+	z.Must(err)
+	defer cancel()
+	_, ch, _ := collect(t, c)
+
+	inst := nacs.Instance{Host: "127.0.0.1", Port: 8080}
+	_, err = c.Register(context.Background(), inst)
+	z.Must(err)
+	assert.Equal(t, []nacs.Instance{inst}, recv(t, lists))
+	assert.Equal(t, nacs.EventAdded, recv(t, ch)[0].Type)
+
+	// a canceled watch gets nothing more
+	cancel()
+	z.Must(c.DeRegister(context.Background(), inst))
+	assert.Equal(t, nacs.EventRemoved, recv(t, ch)[0].Type)
+	assert.Empty(t, lists)
+}
+
+func TestTTL(t *testing.T) {
+	s := NewStore()
+	c := newTestClient(t, s)
+	_, ch, _ := collect(t, c)
+
+	inst := nacs.Instance{Host: "127.0.0.1", Port: 8080}
+	_, err := c.Register(context.Background(), inst)
+	z.Must(err)
+	recv(t, ch)
+
+	// the lease is renewed in the background
+	time.Sleep(c.ttl * 2)
+	assert.Empty(t, ch)
+
+	// the lease expires once the renewals are lost
+	s.Inject(OpKeepalive, Fault{Drop: true})
+	start := time.Now()
+	assert.Equal(t, []nacs.Event{{Type: nacs.EventRemoved, Instance: inst, Revision: 2}}, recv(t, ch))
+	assert.Less(t, time.Since(start), c.ttl*2)
+	s.Heal()
+
+	// a closed client stops renewing
+	other := newTestClient(t, s)
+	_, err = other.Register(context.Background(), inst)
+	z.Must(err)
+	recv(t, ch)
+	other.Close()
+	assert.Equal(t, nacs.EventRemoved, recv(t, ch)[0].Type)
+}
+
+func TestFaults(t *testing.T) {
+	s := NewStore()
+	c := newTestClient(t, s)
+	inst := nacs.Instance{Host: "127.0.0.1", Port: 8080}
+	boom := errors.New("boom")
+
+	s.Inject(OpRegister, Fault{Err: boom})
+	_, err := c.Register(context.Background(), inst)
+	assert.ErrorIs(t, err, boom)
+
+	s.Inject(OpRegister, Fault{Drop: true})
+	_, err = c.Register(context.Background(), inst)
+	z.Must(err)
+	insts, err := c.Discover(context.Background())
+	z.Must(err)
+	assert.Empty(t, insts)
+
+	s.Inject(OpDiscover, Fault{Delay: time.Second})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	_, err = c.Discover(ctx)
+	cancel()
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	s.Heal()
+
+	_, ch, errs := collect(t, c)
+
+	// dropped events are caught up with once healed
+	s.Inject(OpWatch, Fault{Drop: true})
+	_, err = c.Register(context.Background(), inst)
+	z.Must(err)
+	time.Sleep(time.Millisecond * 50)
+	assert.Empty(t, ch)
+	s.Heal(OpWatch)
+	assert.Equal(t, []nacs.Event{{Type: nacs.EventAdded, Instance: inst, Revision: 1}}, recv(t, ch))
+
+	// broken watches report the error and catch up once the fault is lifted
+	s.Inject(OpWatch, Fault{Err: boom})
+	z.Must(c.DeRegister(context.Background(), inst))
+	assert.ErrorIs(t, recv(t, errs), boom)
+	s.Inject(OpWatch, Fault{Delay: time.Millisecond * 100})
+	start := time.Now()
+	assert.Equal(t, []nacs.Event{{Type: nacs.EventRemoved, Instance: inst, Revision: 2}}, recv(t, ch))
+	assert.GreaterOrEqual(t, time.Since(start), time.Millisecond*100)
+}
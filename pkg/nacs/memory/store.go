@@ -0,0 +1,334 @@
+package memory
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cocktail828/go-tools/pkg/nacs"
+)
+
+// Op is an operation of the store which faults can be injected into
+type Op int
+
+const (
+	OpRegister   Op = iota + 1 // Register
+	OpDeRegister               // DeRegister
+	OpDiscover                 // Discover
+	OpKeepalive                // lease renewal of the registered instances
+	OpWatch                    // delivery of the watch events
+)
+
+// Fault describes how an operation misbehaves
+//   - Delay: the operation (or event delivery) is delayed
+//   - Err: the operation fails with Err, watchers receive Err instead of the events
+//   - Drop: the operation is silently lost, watchers miss the events and Discover hangs until ctx is done
+//
+// Watchers which missed events catch up with the difference once the OpWatch fault is healed.
+type Fault struct {
+	Delay time.Duration
+	Err   error
+	Drop  bool
+}
+
+func (f Fault) broken() bool { return f.Drop || f.Err != nil }
+
+var (
+	storesMu sync.Mutex
+	stores   = map[string]*Store{}
+)
+
+// Shared returns the process-wide store of the name, it is created on demand
+// Clients opened by URL with the same host share the same store.
+func Shared(name string) *Store {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	s, ok := stores[name]
+	if !ok {
+		s = NewStore()
+		stores[name] = s
+	}
+	return s
+}
+
+type entry struct {
+	inst  nacs.Instance
+	lease int64
+	timer *time.Timer
+}
+
+// Store keeps the instances in memory, it plays the role of the etcd cluster.
+// Every instance is bound to a lease which expires if it is not renewed in ttl.
+type Store struct {
+	mu       sync.Mutex
+	rev      int64
+	leaseID  int64
+	entries  map[string]*entry // key -> entry
+	watchers map[*watcher]struct{}
+	faults   map[Op]Fault
+}
+
+func NewStore() *Store {
+	return &Store{
+		entries:  map[string]*entry{},
+		watchers: map[*watcher]struct{}{},
+		faults:   map[Op]Fault{},
+	}
+}
+
+// Spawn creates a client scoped to namespace, service and version on the store
+func (s *Store) Spawn(namespace, service, version string) (*MemoryClient, error) {
+	return newMemoryClient(s, namespace, service, version)
+}
+
+// Revision returns the revision of the last change
+func (s *Store) Revision() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rev
+}
+
+// Inject makes the operation misbehave as described by the fault until it is healed
+func (s *Store) Inject(op Op, f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults[op] = f
+	if op == OpWatch && !f.broken() {
+		s.catchUp()
+	}
+}
+
+// Heal removes the faults of the operations, all faults are removed if ops is empty
+func (s *Store) Heal(ops ...Op) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(ops) == 0 {
+		clear(s.faults)
+	}
+	for _, op := range ops {
+		delete(s.faults, op)
+	}
+	s.catchUp()
+}
+
+// inject applies the fault of the operation, drop is true if the operation should be lost
+func (s *Store) inject(ctx context.Context, op Op) (drop bool, err error) {
+	s.mu.Lock()
+	f := s.faults[op]
+	s.mu.Unlock()
+
+	if f.Delay > 0 {
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(f.Delay):
+		}
+	}
+	return f.Drop, f.Err
+}
+
+// put stores the instance with a new lease of ttl, it returns the lease ID
+func (s *Store) put(key string, inst nacs.Instance, ttl time.Duration) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	typ := nacs.EventAdded
+	if old, ok := s.entries[key]; ok {
+		old.timer.Stop()
+		typ = nacs.EventUpdated
+	}
+
+	s.leaseID++
+	lease := s.leaseID
+	s.entries[key] = &entry{
+		inst:  inst,
+		lease: lease,
+		timer: time.AfterFunc(ttl, func() { s.delete(key, lease) }),
+	}
+	s.rev++
+	s.notify(key, nacs.Event{Type: typ, Instance: inst, Revision: s.rev})
+	return lease
+}
+
+// renew resets the ttl of the lease, it returns false if the lease is gone
+func (s *Store) renew(key string, lease int64, ttl time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok || e.lease != lease {
+		return false
+	}
+	e.timer.Reset(ttl)
+	return true
+}
+
+// delete removes the key, lease 0 matches any lease
+func (s *Store) delete(key string, lease int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok || (lease != 0 && e.lease != lease) {
+		return
+	}
+
+	e.timer.Stop()
+	delete(s.entries, key)
+	s.rev++
+	s.notify(key, nacs.Event{Type: nacs.EventRemoved, Instance: e.inst, Revision: s.rev})
+}
+
+// list returns the instances under the prefix, the caller must hold the lock
+func (s *Store) list(prefix string) map[string]nacs.Instance {
+	set := map[string]nacs.Instance{}
+	for key, e := range s.entries {
+		if strings.HasPrefix(key, prefix) {
+			set[e.inst.Addr()] = e.inst
+		}
+	}
+	return set
+}
+
+// notify fans the event out to the watchers of the key, the caller must hold the lock
+func (s *Store) notify(key string, ev nacs.Event) {
+	f := s.faults[OpWatch]
+	for w := range s.watchers {
+		if !strings.HasPrefix(key, w.prefix) {
+			continue
+		}
+
+		switch {
+		case f.Drop:
+			w.stale = true
+		case f.Err != nil:
+			w.stale = true
+			w.push(batch{err: f.Err, delay: f.Delay})
+		case w.stale:
+			w.resync(s.list(w.prefix), s.rev, f.Delay)
+		default:
+			nacs.Apply(w.known, []nacs.Event{ev})
+			w.push(batch{evs: []nacs.Event{ev}, delay: f.Delay})
+		}
+	}
+}
+
+// catchUp delivers the missed changes to the stale watchers, the caller must hold the lock
+func (s *Store) catchUp() {
+	f := s.faults[OpWatch]
+	if f.broken() {
+		return
+	}
+	for w := range s.watchers {
+		if w.stale {
+			w.resync(s.list(w.prefix), s.rev, f.Delay)
+		}
+	}
+}
+
+// watch registers a watcher on the prefix, the current instances are returned as Added events
+func (s *Store) watch(prefix string, callback func([]nacs.Event, error)) (*watcher, []nacs.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	set := s.list(prefix)
+	evs := nacs.Diff(nil, nacs.Instances(set))
+	for i := range evs {
+		evs[i].Revision = s.rev
+	}
+
+	w := &watcher{
+		prefix:   prefix,
+		known:    set,
+		callback: callback,
+		signal:   make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	s.watchers[w] = struct{}{}
+	return w, evs
+}
+
+func (s *Store) unwatch(w *watcher) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.watchers[w]; ok {
+		delete(s.watchers, w)
+		close(w.done)
+	}
+}
+
+type batch struct {
+	evs   []nacs.Event
+	err   error
+	delay time.Duration
+}
+
+// watcher delivers the events in order on its own goroutine, so a slow callback never blocks the store
+type watcher struct {
+	prefix   string
+	known    map[string]nacs.Instance // instances delivered so far, guarded by the store lock
+	stale    bool                     // events are missed, guarded by the store lock
+	callback func([]nacs.Event, error)
+
+	mu     sync.Mutex
+	queue  []batch
+	signal chan struct{}
+	done   chan struct{}
+}
+
+// resync delivers the difference between the known and the current instances
+func (w *watcher) resync(set map[string]nacs.Instance, rev int64, delay time.Duration) {
+	w.stale = false
+	evs := nacs.Diff(nacs.Instances(w.known), nacs.Instances(set))
+	if len(evs) == 0 {
+		return
+	}
+	for i := range evs {
+		evs[i].Revision = rev
+	}
+	w.known = set
+	w.push(batch{evs: evs, delay: delay})
+}
+
+func (w *watcher) push(b batch) {
+	w.mu.Lock()
+	w.queue = append(w.queue, b)
+	w.mu.Unlock()
+
+	select {
+	case w.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (w *watcher) loop() {
+	for {
+		w.mu.Lock()
+		if len(w.queue) == 0 {
+			w.mu.Unlock()
+			select {
+			case <-w.done:
+				return
+			case <-w.signal:
+			}
+			continue
+		}
+		b := w.queue[0]
+		w.queue = w.queue[1:]
+		w.mu.Unlock()
+
+		if b.delay > 0 {
+			select {
+			case <-w.done:
+				return
+			case <-time.After(b.delay):
+			}
+		}
+
+		select {
+		case <-w.done:
+			return
+		default:
+			w.callback(b.evs, b.err)
+		}
+	}
+}
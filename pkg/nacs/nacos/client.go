@@ -14,6 +14,23 @@ import (
 var _ nacs.Registry = &NacosClient{}
 var _ nacs.Configor = &NacosClient{}
 
+func init() {
+	nacs.RegisterRegistry("nacos", func(u *url.URL) (nacs.Registry, error) {
+		c, err := NewNacosClient(u)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	})
+	nacs.RegisterConfigor("nacos", func(u *url.URL) (nacs.Configor, error) {
+		c, err := NewNacosClient(u)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	})
+}
+
 type NacosClient struct {
 	inGroup    string // group
 	inService  string // service
@@ -209,3 +226,11 @@ func (c *NacosClient) Monitor(cb func(nacs.ConfigInfo, error)) (context.CancelFu
 		})
 	}, nil
 }
+
+// WatchEvents diffs the instance lists delivered by Watch into incremental events
+func (c *NacosClient) WatchEvents(callback func([]nacs.Event, error)) (context.CancelFunc, error) {
+	if callback == nil {
+		return nil, errors.New("callback is nil")
+	}
+	return nacs.WatchDiff(c, callback)
+}
@@ -69,3 +69,22 @@ func TestNaming(t *testing.T) {
 
 	<-ctx.Done()
 }
+
+func TestPublisher(t *testing.T) {
+	ver, err := ncs.Publish(context.Background(), []byte("hello"), nacs.AnyVersion)
+	z.Must(err)
+	_, err = ncs.Publish(context.Background(), []byte("world"), ver-1)
+	assert.ErrorIs(t, err, nacs.ErrConflict)
+
+	info, err := ncs.Load(context.Background())
+	z.Must(err)
+	assert.Equal(t, "hello", string(info.Payload))
+
+	_, err = ncs.Publish(context.Background(), []byte("world"), ver)
+	z.Must(err)
+	_, err = ncs.Rollback(context.Background(), ver)
+	z.Must(err)
+	info, err = ncs.Load(context.Background())
+	z.Must(err)
+	assert.Equal(t, "hello", string(info.Payload))
+}
@@ -0,0 +1,133 @@
+package nacos
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/cocktail828/go-tools/pkg/nacs"
+	"github.com/nacos-group/nacos-sdk-go/v2/vo"
+	"github.com/pkg/errors"
+)
+
+var _ nacs.Publisher = &NacosClient{}
+
+// MaxHistory is the max number of versions kept in the history of a config
+var MaxHistory = 20
+
+// HistoryID returns the data ID keeping the published versions of the config: $service_$version.history
+// Nacos has no versions itself, the history is kept as a json config next to the config.
+func (c *NacosClient) HistoryID() string { return c.ConfigID() + ".history" }
+
+func md5sum(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *NacosClient) get(id string) (string, error) {
+	return c.baseClient.configClient.GetConfig(vo.ConfigParam{DataId: id, Group: c.inGroup})
+}
+
+// put publishes the content, the content is compared by md5 with prev unless prev is empty
+func (c *NacosClient) put(id, content, prev string) error {
+	param := vo.ConfigParam{DataId: id, Group: c.inGroup, Content: content}
+	if prev != "" {
+		param.CasMd5 = md5sum(prev)
+	}
+	ok, err := c.baseClient.configClient.PublishConfig(param)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.Errorf("nacos: publish config %s fail", id)
+	}
+	return nil
+}
+
+// history returns the versions, the latest first, and the raw content of the history config
+func (c *NacosClient) history() ([]nacs.ConfigVersion, string, error) {
+	raw, err := c.get(c.HistoryID())
+	if err != nil || raw == "" {
+		return nil, raw, err
+	}
+
+	var hist []nacs.ConfigVersion
+	if err := json.Unmarshal([]byte(raw), &hist); err != nil {
+		return nil, raw, errors.Wrapf(err, "nacos: invalid history %s", c.HistoryID())
+	}
+	return hist, raw, nil
+}
+
+// Publish publishes the config and records it in the history, both are compare-and-swap on the md5 of the content.
+// The version of the config is the latest version in the history, it is 0 if the config does not exist.
+// Changes made outside of Publish are not versioned.
+func (c *NacosClient) Publish(ctx context.Context, payload []byte, expect int64) (int64, error) {
+	hist, raw, err := c.history()
+	if err != nil {
+		return 0, err
+	}
+	current, err := c.get(c.ConfigID())
+	if err != nil {
+		return 0, err
+	}
+
+	var latest, version int64
+	if len(hist) > 0 {
+		latest = hist[0].Version
+	}
+	if current != "" {
+		version = latest
+	}
+	if expect != nacs.AnyVersion && expect != version {
+		return 0, nacs.ErrConflict
+	}
+
+	if err := c.put(c.ConfigID(), string(payload), current); err != nil {
+		return 0, err
+	}
+
+	hist = append([]nacs.ConfigVersion{{Version: latest + 1, Payload: payload, Time: time.Now()}}, hist...)
+	if len(hist) > MaxHistory {
+		hist = hist[:MaxHistory]
+	}
+	data, err := json.Marshal(hist)
+	if err != nil {
+		return 0, err
+	}
+	if err := c.put(c.HistoryID(), string(data), raw); err != nil {
+		return 0, errors.Wrapf(err, "nacos: config is published but the history is not")
+	}
+	return latest + 1, nil
+}
+
+// Delete deletes the config, the history is kept for rollback
+func (c *NacosClient) Delete(ctx context.Context) error {
+	_, err := c.baseClient.configClient.DeleteConfig(vo.ConfigParam{DataId: c.ConfigID(), Group: c.inGroup})
+	return err
+}
+
+func (c *NacosClient) History(ctx context.Context, limit int) ([]nacs.ConfigVersion, error) {
+	hist, _, err := c.history()
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(hist) > limit {
+		hist = hist[:limit]
+	}
+	return hist, nil
+}
+
+func (c *NacosClient) Rollback(ctx context.Context, version int64) (int64, error) {
+	hist, _, err := c.history()
+	if err != nil {
+		return 0, err
+	}
+	for _, v := range hist {
+		if v.Version == version {
+			return c.Publish(ctx, v.Payload, nacs.AnyVersion)
+		}
+	}
+	return 0, errors.Errorf("config %s has no version %d", c.ConfigID(), version)
+}
@@ -2,6 +2,8 @@ package nacs
 
 import (
 	"context"
+	"net"
+	"strconv"
 )
 
 // Instance represents a service instance
@@ -13,6 +15,12 @@ type Instance struct {
 	Meta    map[string]string // instance metadata
 }
 
+// Addr returns the instance address in format: $host:$port
+// It is used to identify the service instance.
+func (i Instance) Addr() string {
+	return net.JoinHostPort(i.Host, strconv.FormatUint(uint64(i.Port), 10))
+}
+
 // Registry is a service registry interface
 // Service details such as service name, service version, and cluster information
 // are determined by the registry implementation (typically via construction parameters)
@@ -32,5 +40,10 @@ type Registry interface {
 	// The callback is invoked when instances change
 	Watch(callback func([]Instance, error)) (context.CancelFunc, error)
 
+	// WatchEvents watches service instance changes incrementally
+	// The callback is first invoked with an Added event for every existing instance,
+	// then with the Added/Updated/Removed events of every change
+	WatchEvents(callback func([]Event, error)) (context.CancelFunc, error)
+
 	Close() error
 }
@@ -5,17 +5,23 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/cocktail828/go-tools/pkg/nacs"
 	"github.com/pkg/errors"
 	"gopkg.in/fsnotify.v1"
 )
 
+func init() {
+	nacs.RegisterConfigor("file", NewFileConfigor)
+}
+
 type fileConfigor struct {
 	rctx    context.Context
 	rcancel context.CancelFunc
 
 	fpath   string
+	mu      sync.Mutex // guards the payload and serializes the publishing
 	payload []byte
 	err     error
 }
@@ -46,6 +52,8 @@ func (f *fileConfigor) loadConfigLocked(fpath string) ([]byte, error) {
 }
 
 func (f *fileConfigor) Load(ctx context.Context) (nacs.ConfigInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	return nacs.ConfigInfo{
 		DataID:  f.fpath,
 		Payload: f.payload,
@@ -80,7 +88,9 @@ func (f *fileConfigor) Monitor(cb func(nacs.ConfigInfo, error)) (context.CancelF
 				}
 
 				if event.Op&fsnotify.Write == fsnotify.Write {
+					f.mu.Lock()
 					payload, err := f.loadConfigLocked(event.Name)
+					f.mu.Unlock()
 					cb(nacs.ConfigInfo{
 						DataID:  event.Name,
 						Payload: payload,
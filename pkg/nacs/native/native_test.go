@@ -2,9 +2,11 @@ package native
 
 import (
 	"context"
+	"fmt"
 	"net/url"
 	"os"
 	"path"
+	"sync"
 	"testing"
 	"time"
 
@@ -57,3 +59,88 @@ func TestNative(t *testing.T) {
 		}
 	}
 }
+
+func TestPublisher(t *testing.T) {
+	fpath := path.Join(t.TempDir(), "config.toml")
+	z.Must(os.WriteFile(fpath, []byte("v0"), os.ModePerm))
+	u, err := url.ParseRequestURI("file://" + fpath)
+	z.Must(err)
+	configor, err := NewFileConfigor(u)
+	z.Must(err)
+	defer configor.Close()
+	pub := configor.(nacs.Publisher)
+
+	// nothing is published yet
+	_, err = pub.Publish(context.Background(), []byte("v1"), 1)
+	assert.ErrorIs(t, err, nacs.ErrConflict)
+	ver, err := pub.Publish(context.Background(), []byte("v1"), 0)
+	z.Must(err)
+	assert.Equal(t, int64(1), ver)
+
+	_, err = pub.Publish(context.Background(), []byte("v2"), 0)
+	assert.ErrorIs(t, err, nacs.ErrConflict)
+	ver, err = pub.Publish(context.Background(), []byte("v2"), ver)
+	z.Must(err)
+	assert.Equal(t, int64(2), ver)
+
+	info, err := configor.Load(context.Background())
+	z.Must(err)
+	assert.Equal(t, "v2", string(info.Payload))
+
+	hist, err := pub.History(context.Background(), 0)
+	z.Must(err)
+	assert.Len(t, hist, 2)
+	assert.Equal(t, "v2", string(hist[0].Payload))
+	assert.Equal(t, int64(1), hist[1].Version)
+
+	// the history survives the deletion
+	z.Must(pub.Delete(context.Background()))
+	_, err = configor.Load(context.Background())
+	assert.Error(t, err)
+	ver, err = pub.Rollback(context.Background(), 1)
+	z.Must(err)
+	assert.Equal(t, int64(3), ver)
+	data, err := os.ReadFile(fpath)
+	z.Must(err)
+	assert.Equal(t, "v1", string(data))
+
+	_, err = pub.Rollback(context.Background(), 10)
+	assert.Error(t, err)
+	hist, err = pub.History(context.Background(), 1)
+	z.Must(err)
+	assert.Len(t, hist, 1)
+	assert.Equal(t, int64(3), hist[0].Version)
+}
+
+func TestPublisherConcurrentLoad(t *testing.T) {
+	fpath := path.Join(t.TempDir(), "config.toml")
+	z.Must(os.WriteFile(fpath, []byte("v0"), os.ModePerm))
+	u, err := url.ParseRequestURI("file://" + fpath)
+	z.Must(err)
+	configor, err := NewFileConfigor(u)
+	z.Must(err)
+	defer configor.Close()
+	pub := configor.(nacs.Publisher)
+
+	cancel, err := configor.Monitor(func(nacs.ConfigInfo, error) {})
+	z.Must(err)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			_, err := pub.Publish(context.Background(), []byte(fmt.Sprintf("v%d", i)), nacs.AnyVersion)
+			assert.NoError(t, err)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		configor.Load(context.Background())
+	}
+	wg.Wait()
+
+	info, err := configor.Load(context.Background())
+	z.Must(err)
+	assert.Equal(t, "v19", string(info.Payload))
+}
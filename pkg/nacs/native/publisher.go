@@ -0,0 +1,119 @@
+package native
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/cocktail828/go-tools/pkg/nacs"
+	"github.com/pkg/errors"
+)
+
+var _ nacs.Publisher = &fileConfigor{}
+
+// MaxHistory is the max number of versions kept in the history of a config file
+var MaxHistory = 20
+
+// historyPath returns the file keeping the published versions: $path.history
+func (f *fileConfigor) historyPath() string { return f.fpath + ".history" }
+
+func (f *fileConfigor) history() ([]nacs.ConfigVersion, error) {
+	data, err := os.ReadFile(f.historyPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var hist []nacs.ConfigVersion
+	if err := json.Unmarshal(data, &hist); err != nil {
+		return nil, errors.Wrapf(err, "invalid history %s", f.historyPath())
+	}
+	return hist, nil
+}
+
+// Publish writes the file in place, so the monitors see a write event, and records it in the history.
+// The version of the config is the latest version in the history, it is 0 if the file does not exist.
+// Changes made outside of Publish are not versioned.
+func (f *fileConfigor) Publish(ctx context.Context, payload []byte, expect int64) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	hist, err := f.history()
+	if err != nil {
+		return 0, err
+	}
+
+	var latest, version int64
+	if len(hist) > 0 {
+		latest = hist[0].Version
+	}
+	if _, err := os.Stat(f.fpath); err == nil {
+		version = latest
+	}
+	if expect != nacs.AnyVersion && expect != version {
+		return 0, nacs.ErrConflict
+	}
+
+	if err := os.WriteFile(f.fpath, payload, 0o644); err != nil {
+		return 0, err
+	}
+	if _, err := f.loadConfigLocked(f.fpath); err != nil {
+		return 0, errors.Wrap(err, "reload the published config")
+	}
+
+	hist = append([]nacs.ConfigVersion{{Version: latest + 1, Payload: payload, Time: time.Now()}}, hist...)
+	if len(hist) > MaxHistory {
+		hist = hist[:MaxHistory]
+	}
+	data, err := json.Marshal(hist)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.WriteFile(f.historyPath(), data, 0o644); err != nil {
+		return 0, errors.Wrap(err, "config is published but the history is not")
+	}
+	return latest + 1, nil
+}
+
+// Delete removes the file, the history is kept for rollback
+func (f *fileConfigor) Delete(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := os.Remove(f.fpath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// the payload is gone, the error of loading it is expected
+	if _, err := f.loadConfigLocked(f.fpath); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "reload the deleted config")
+	}
+	return nil
+}
+
+func (f *fileConfigor) History(ctx context.Context, limit int) ([]nacs.ConfigVersion, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	hist, err := f.history()
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(hist) > limit {
+		hist = hist[:limit]
+	}
+	return hist, nil
+}
+
+func (f *fileConfigor) Rollback(ctx context.Context, version int64) (int64, error) {
+	hist, err := f.History(ctx, 0)
+	if err != nil {
+		return 0, err
+	}
+	for _, v := range hist {
+		if v.Version == version {
+			return f.Publish(ctx, v.Payload, nacs.AnyVersion)
+		}
+	}
+	return 0, errors.Errorf("config %s has no version %d", f.fpath, version)
+}
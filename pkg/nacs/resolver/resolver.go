@@ -0,0 +1,219 @@
+package resolver
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cocktail828/go-tools/algo/balancer"
+	"github.com/cocktail828/go-tools/exp/healthy"
+	"github.com/cocktail828/go-tools/pkg/nacs"
+	"github.com/cocktail828/go-tools/xlog"
+	"github.com/pkg/errors"
+)
+
+var (
+	// DefaultWeight is the node weight if the instance has no valid 'weight' metadata
+	DefaultWeight = 100
+	// DefaultProbeInterval is how often the default keepalive probes an instance
+	DefaultProbeInterval = 5 * time.Second
+)
+
+var errMarkFailure = errors.New("resolver: node is marked as failure")
+
+type option struct {
+	keepalive     func(nacs.Instance) healthy.Keepalive
+	probeInterval time.Duration
+	logger        xlog.Printer
+}
+
+type Option func(*option)
+
+// WithKeepalive sets the keepalive factory, it is called once per instance
+func WithKeepalive(f func(nacs.Instance) healthy.Keepalive) Option {
+	return func(o *option) { o.keepalive = f }
+}
+
+// WithProbeInterval sets the background probing interval of the keepalive, 0 disables probing
+func WithProbeInterval(itvl time.Duration) Option {
+	return func(o *option) { o.probeInterval = itvl }
+}
+
+func WithLogger(logger xlog.Printer) Option {
+	return func(o *option) { o.logger = logger }
+}
+
+// instanceNode adapts a nacs.Instance to balancer.Node
+type instanceNode struct {
+	addr      string
+	inst      atomic.Pointer[nacs.Instance]
+	weight    atomic.Int64
+	keepalive healthy.Keepalive
+	stop      context.CancelFunc
+}
+
+func (n *instanceNode) update(inst nacs.Instance) {
+	weight := DefaultWeight
+	if val, err := strconv.Atoi(inst.Meta["weight"]); err == nil && val >= 0 {
+		weight = val
+	}
+	n.inst.Store(&inst)
+	n.weight.Store(int64(weight))
+}
+
+func (n *instanceNode) MarkFailure()  { n.keepalive.Check(errMarkFailure) }
+func (n *instanceNode) Healthy() bool { return n.keepalive.Alive() }
+func (n *instanceNode) Weight() int   { return int(n.weight.Load()) }
+func (n *instanceNode) Value() any    { return n.addr }
+
+// Locality returns the "region" and "zone" metadata of the instance
+func (n *instanceNode) Locality() (string, string) {
+	inst := n.inst.Load()
+	return inst.Meta["region"], inst.Meta["zone"]
+}
+
+// Resolver subscribes to a registry and keeps a balancer updated with the discovered instances.
+// Every instance gets its own keepalive, which decides whether the node is healthy.
+type Resolver struct {
+	opt      *option
+	balancer balancer.Balancer
+	cancel   context.CancelFunc
+
+	mu    sync.RWMutex
+	nodes map[string]*instanceNode // addr -> node
+}
+
+// NewResolver creates a resolver on the registry, builder creates the balancer strategy, e.g. balancer.NewWeightRoundRobin
+// It returns once the current instances are discovered.
+func NewResolver(r nacs.Registry, builder func([]balancer.Node) balancer.Balancer, opts ...Option) (*Resolver, error) {
+	o := &option{
+		probeInterval: DefaultProbeInterval,
+		logger:        xlog.NopPrinter{},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.keepalive == nil {
+		o.keepalive = func(inst nacs.Instance) healthy.Keepalive {
+			return healthy.NewKeepalive(
+				healthy.NewCounterEvaluater(3, 5),
+				healthy.SocketProbe{Addr: inst.Addr(), Network: "tcp", Timeout: time.Second},
+				o.logger,
+			)
+		}
+	}
+
+	res := &Resolver{
+		opt:      o,
+		balancer: builder(nil),
+		nodes:    map[string]*instanceNode{},
+	}
+
+	cancel, err := r.WatchEvents(func(evs []nacs.Event, err error) {
+		if err != nil {
+			o.logger.Printf("resolver: watch instances fail: %v", err)
+			return
+		}
+		res.apply(evs)
+	})
+	if err != nil {
+		res.Close()
+		return nil, err
+	}
+	res.cancel = cancel
+	return res, nil
+}
+
+func (r *Resolver) apply(evs []nacs.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, ev := range evs {
+		addr := ev.Instance.Addr()
+		node, ok := r.nodes[addr]
+		switch {
+		case ev.Type == nacs.EventRemoved:
+			if ok {
+				node.stop()
+				delete(r.nodes, addr)
+			}
+
+		case ok:
+			node.update(ev.Instance)
+
+		default:
+			node = &instanceNode{addr: addr, keepalive: r.opt.keepalive(ev.Instance)}
+			node.update(ev.Instance)
+			node.stop = node.keepalive.Background(r.opt.probeInterval)
+			r.nodes[addr] = node
+		}
+	}
+
+	nodes := make([]balancer.Node, 0, len(r.nodes))
+	for _, node := range r.nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Value().(string) < nodes[j].Value().(string) })
+	r.balancer.Update(nodes)
+}
+
+// Balancer returns the underlying balancer
+func (r *Resolver) Balancer() balancer.Balancer { return r.balancer }
+
+// Instances returns all discovered instances, healthy or not
+func (r *Resolver) Instances() []nacs.Instance {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	set := make(map[string]nacs.Instance, len(r.nodes))
+	for addr, node := range r.nodes {
+		set[addr] = *node.inst.Load()
+	}
+	return nacs.Instances(set)
+}
+
+// Pick picks an instance by the balancer
+// It returns false if no instance is available
+func (r *Resolver) Pick() (nacs.Instance, bool) {
+	n := r.balancer.Pick()
+	if n == nil {
+		return nacs.Instance{}, false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	node, ok := r.nodes[n.Value().(string)]
+	if !ok {
+		return nacs.Instance{}, false
+	}
+	return *node.inst.Load(), true
+}
+
+// Check feeds the result of a request on the instance into its keepalive
+func (r *Resolver) Check(inst nacs.Instance, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if node, ok := r.nodes[inst.Addr()]; ok {
+		node.keepalive.Check(err)
+	}
+}
+
+// Close stops watching the registry and probing the instances, the registry is not closed
+func (r *Resolver) Close() error {
+	if r.cancel != nil {
+		r.cancel()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for addr, node := range r.nodes {
+		node.stop()
+		delete(r.nodes, addr)
+	}
+	r.balancer.Update(nil)
+	return nil
+}
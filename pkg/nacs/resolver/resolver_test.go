@@ -0,0 +1,171 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cocktail828/go-tools/algo/balancer"
+	"github.com/cocktail828/go-tools/exp/healthy"
+	"github.com/cocktail828/go-tools/pkg/nacs"
+	"github.com/cocktail828/go-tools/z"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRegistry delivers the events pushed by the test
+type fakeRegistry struct {
+	nacs.Registry
+	insts    []nacs.Instance
+	callback func([]nacs.Event, error)
+}
+
+func (r *fakeRegistry) WatchEvents(callback func([]nacs.Event, error)) (context.CancelFunc, error) {
+	r.callback = callback
+	callback(nacs.Diff(nil, r.insts), nil)
+	return func() {}, nil
+}
+
+func (r *fakeRegistry) set(insts []nacs.Instance) {
+	evs := nacs.Diff(r.insts, insts)
+	r.insts = insts
+	r.callback(evs, nil)
+}
+
+// fakeKeepalive is healthy until it sees an error
+type fakeKeepalive struct {
+	alive   atomic.Bool
+	stopped atomic.Bool
+}
+
+func (k *fakeKeepalive) Alive() bool     { return k.alive.Load() }
+func (k *fakeKeepalive) Check(err error) { k.alive.Store(err == nil) }
+func (k *fakeKeepalive) Background(itvl time.Duration) context.CancelFunc {
+	return func() { k.stopped.Store(true) }
+}
+
+func TestResolver(t *testing.T) {
+	a := nacs.Instance{Service: "svc", Host: "10.0.0.1", Port: 80, Meta: map[string]string{"weight": "3"}}
+	b := nacs.Instance{Service: "svc", Host: "10.0.0.2", Port: 80, Meta: map[string]string{"weight": "1"}}
+	c := nacs.Instance{Service: "svc", Host: "10.0.0.3", Port: 80}
+	reg := &fakeRegistry{insts: []nacs.Instance{a, b}}
+
+	keepalives := map[string]*fakeKeepalive{}
+	r, err := NewResolver(reg, balancer.NewWeightRoundRobin, WithKeepalive(func(inst nacs.Instance) healthy.Keepalive {
+		k := &fakeKeepalive{}
+		k.alive.Store(true)
+		keepalives[inst.Addr()] = k
+		return k
+	}))
+	z.Must(err)
+	defer r.Close()
+
+	assert.Equal(t, []nacs.Instance{a, b}, r.Instances())
+
+	cnt := map[string]int{}
+	for range 400 {
+		inst, ok := r.Pick()
+		assert.True(t, ok)
+		cnt[inst.Addr()]++
+	}
+	assert.Equal(t, map[string]int{a.Addr(): 300, b.Addr(): 100}, cnt)
+
+	// weight updates are applied in place
+	a.Meta = map[string]string{"weight": "1"}
+	reg.set([]nacs.Instance{a, b, c})
+	assert.Equal(t, []nacs.Instance{a, b, c}, r.Instances())
+	for _, node := range r.Balancer().Nodes() {
+		if node.Value() == c.Addr() {
+			assert.Equal(t, DefaultWeight, node.Weight())
+		} else {
+			assert.Equal(t, 1, node.Weight())
+		}
+	}
+
+	// removed instances stop probing
+	reg.set([]nacs.Instance{b})
+	assert.True(t, keepalives[a.Addr()].stopped.Load())
+	assert.True(t, keepalives[c.Addr()].stopped.Load())
+	inst, ok := r.Pick()
+	assert.True(t, ok)
+	assert.Equal(t, b, inst)
+
+	// the keepalive decides the health
+	r.Check(b, errors.New("boom"))
+	_, ok = r.Pick()
+	assert.False(t, ok)
+	r.Check(b, nil)
+	_, ok = r.Pick()
+	assert.True(t, ok)
+}
+
+func TestResolverDefaultKeepalive(t *testing.T) {
+	reg := &fakeRegistry{insts: []nacs.Instance{{Host: "127.0.0.1", Port: 1}}}
+	r, err := NewResolver(reg, balancer.NewRoundRobin, WithProbeInterval(0))
+	z.Must(err)
+	defer r.Close()
+
+	inst, ok := r.Pick()
+	assert.True(t, ok)
+	assert.Equal(t, uint(1), inst.Port)
+
+	// the counter evaluater turns unhealthy after more than 3 failures
+	for range 4 {
+		r.Check(inst, errors.New("boom"))
+	}
+	time.Sleep(time.Millisecond * 120) // keepalive caches the health for 100ms
+	_, ok = r.Pick()
+	assert.False(t, ok)
+
+	r.Close()
+	assert.Empty(t, r.Instances())
+	assert.Empty(t, r.Balancer().Nodes())
+}
+
+func TestResolverLocality(t *testing.T) {
+	local := nacs.Instance{Service: "svc", Host: "10.0.0.1", Port: 80, Meta: map[string]string{"region": "r1", "zone": "a"}}
+	region := nacs.Instance{Service: "svc", Host: "10.0.0.2", Port: 80, Meta: map[string]string{"region": "r1", "zone": "b"}}
+	remote := nacs.Instance{Service: "svc", Host: "10.0.0.3", Port: 80}
+	reg := &fakeRegistry{insts: []nacs.Instance{local, region, remote}}
+
+	keepalives := map[string]*fakeKeepalive{}
+	r, err := NewResolver(reg, balancer.WithLocality(balancer.NewRoundRobin, balancer.Locality{Region: "r1", Zone: "a"}),
+		WithKeepalive(func(inst nacs.Instance) healthy.Keepalive {
+			k := &fakeKeepalive{}
+			k.alive.Store(true)
+			keepalives[inst.Addr()] = k
+			return k
+		}))
+	z.Must(err)
+	defer r.Close()
+
+	for _, n := range r.Balancer().Nodes() {
+		_, ok := n.(balancer.Located)
+		assert.True(t, ok)
+	}
+
+	pick := func() map[string]int {
+		cnt := map[string]int{}
+		for range 100 {
+			inst, ok := r.Pick()
+			assert.True(t, ok)
+			cnt[inst.Addr()]++
+		}
+		return cnt
+	}
+	assert.Equal(t, map[string]int{local.Addr(): 100}, pick())
+
+	// the traffic spills to the same region, then elsewhere
+	r.Check(local, errors.New("boom"))
+	assert.Equal(t, map[string]int{region.Addr(): 100}, pick())
+	r.Check(region, errors.New("boom"))
+	assert.Equal(t, map[string]int{remote.Addr(): 100}, pick())
+
+	// the metadata changes move the instance
+	remote.Meta = map[string]string{"region": "r1", "zone": "a"}
+	reg.set([]nacs.Instance{local, region, remote})
+	r.Check(local, nil)
+	cnt := pick()
+	assert.Equal(t, 100, cnt[local.Addr()]+cnt[remote.Addr()])
+}
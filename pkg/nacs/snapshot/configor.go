@@ -0,0 +1,142 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"sync"
+
+	"github.com/cocktail828/go-tools/pkg/nacs"
+	"github.com/pkg/errors"
+)
+
+var _ nacs.Configor = &Configor{}
+
+// Configor persists the last config loaded from the backend to $dir/$name,
+// the snapshot is served when the backend is down.
+type Configor struct {
+	backend nacs.Configor
+	file    file
+	stale   stale
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+// NewConfigor wraps the configor, the snapshot is kept in the file $dir/$name
+func NewConfigor(c nacs.Configor, dir, name string) (*Configor, error) {
+	f, err := newFile(dir, name)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Configor{backend: c, file: f, ctx: ctx, cancel: cancel}, nil
+}
+
+// Stale reports whether the config is served from the snapshot
+func (c *Configor) Stale() bool { return c.stale.get() }
+
+func (c *Configor) Load(ctx context.Context) (nacs.ConfigInfo, error) {
+	info, err := c.backend.Load(ctx)
+	if err == nil {
+		c.stale.set(false)
+		c.file.save(info)
+		return info, nil
+	}
+
+	var snap nacs.ConfigInfo
+	if c.file.load(&snap) != nil {
+		return nacs.ConfigInfo{}, err
+	}
+	c.stale.set(true)
+	return snap, nil
+}
+
+// Monitor monitors the backend, the snapshot is updated on every change.
+// While the config is stale the backend is polled, and the fresh config is delivered once it recovers.
+func (c *Configor) Monitor(cb func(nacs.ConfigInfo, error)) (context.CancelFunc, error) {
+	if cb == nil {
+		return nil, errors.New("callback is nil")
+	}
+
+	var mu sync.Mutex
+	var last []byte
+	if c.Stale() {
+		var snap nacs.ConfigInfo
+		c.file.load(&snap)
+		last = snap.Payload
+	}
+	deliver := func(info nacs.ConfigInfo, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			cb(info, err)
+			return
+		}
+
+		c.stale.set(false)
+		c.file.save(info)
+		last = info.Payload
+		cb(info, nil)
+	}
+
+	ctx, cancel := context.WithCancel(c.ctx)
+	var bcancel context.CancelFunc
+	var bmu sync.Mutex
+	subscribe := func() error {
+		bc, err := c.backend.Monitor(deliver)
+		if err != nil {
+			return err
+		}
+
+		bmu.Lock()
+		defer bmu.Unlock()
+		if ctx.Err() != nil {
+			bc()
+		} else {
+			bcancel = bc
+		}
+		return nil
+	}
+
+	if err := subscribe(); err != nil {
+		if !c.Stale() {
+			cancel()
+			return nil, err
+		}
+		go retry(ctx, subscribe)
+	}
+
+	if c.Stale() {
+		go retry(ctx, func() error {
+			info, err := c.backend.Load(ctx)
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			c.stale.set(false)
+			c.file.save(info)
+			if !bytes.Equal(last, info.Payload) {
+				last = info.Payload
+				cb(info, nil)
+			}
+			return nil
+		})
+	}
+
+	return func() {
+		cancel()
+		bmu.Lock()
+		defer bmu.Unlock()
+		if bcancel != nil {
+			bcancel()
+		}
+	}, nil
+}
+
+// Close stops the retries and closes the backend
+func (c *Configor) Close() error {
+	c.cancel()
+	return c.backend.Close()
+}
@@ -0,0 +1,174 @@
+package snapshot
+
+import (
+	"context"
+	"sync"
+
+	"github.com/cocktail828/go-tools/pkg/nacs"
+	"github.com/pkg/errors"
+)
+
+var _ nacs.Registry = &Registry{}
+
+// Registry persists the last instances discovered from the backend to $dir/$name,
+// the snapshot is served when the backend is down.
+type Registry struct {
+	backend nacs.Registry
+	file    file
+	stale   stale
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+// NewRegistry wraps the registry, the snapshot is kept in the file $dir/$name
+func NewRegistry(r nacs.Registry, dir, name string) (*Registry, error) {
+	f, err := newFile(dir, name)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Registry{backend: r, file: f, ctx: ctx, cancel: cancel}, nil
+}
+
+// Stale reports whether the instances are served from the snapshot
+func (r *Registry) Stale() bool { return r.stale.get() }
+
+func (r *Registry) Register(ctx context.Context, inst nacs.Instance) (context.CancelFunc, error) {
+	return r.backend.Register(ctx, inst)
+}
+
+func (r *Registry) DeRegister(ctx context.Context, inst nacs.Instance) error {
+	return r.backend.DeRegister(ctx, inst)
+}
+
+func (r *Registry) Discover(ctx context.Context) ([]nacs.Instance, error) {
+	insts, err := r.backend.Discover(ctx)
+	if err == nil {
+		r.stale.set(false)
+		r.file.save(insts)
+		return insts, nil
+	}
+
+	var snap []nacs.Instance
+	if r.file.load(&snap) != nil {
+		return nil, err
+	}
+	r.stale.set(true)
+	return snap, nil
+}
+
+func (r *Registry) Watch(callback func([]nacs.Instance, error)) (context.CancelFunc, error) {
+	if callback == nil {
+		return nil, errors.New("callback is nil")
+	}
+
+	set := map[string]nacs.Instance{}
+	synced := false
+	return r.WatchEvents(func(evs []nacs.Event, err error) {
+		if err != nil {
+			callback(nil, err)
+			return
+		}
+
+		nacs.Apply(set, evs)
+		// the initial instances are not a change
+		if !synced {
+			synced = true
+			return
+		}
+		callback(nacs.Instances(set), nil)
+	})
+}
+
+// WatchEvents watches the backend, the snapshot is updated on every change.
+// If the backend is down the snapshot is delivered as the initial instances and the backend is retried,
+// once it recovers the difference to the snapshot is delivered.
+func (r *Registry) WatchEvents(callback func([]nacs.Event, error)) (context.CancelFunc, error) {
+	if callback == nil {
+		return nil, errors.New("callback is nil")
+	}
+
+	var mu sync.Mutex
+	set := map[string]nacs.Instance{}
+	initial := true   // the first callback is delivered already
+	resyncing := true // the next backend batch lists all instances
+	deliver := func(evs []nacs.Event, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			callback(nil, err)
+			return
+		}
+
+		if resyncing {
+			resyncing = false
+			curr := map[string]nacs.Instance{}
+			nacs.Apply(curr, evs)
+			evs = nacs.Diff(nacs.Instances(set), nacs.Instances(curr))
+			if !initial && len(evs) == 0 {
+				r.stale.set(false)
+				r.file.save(nacs.Instances(curr))
+				return
+			}
+		}
+
+		nacs.Apply(set, evs)
+		r.stale.set(false)
+		r.file.save(nacs.Instances(set))
+		initial = false
+		callback(evs, nil)
+	}
+
+	ctx, cancel := context.WithCancel(r.ctx)
+	var bcancel context.CancelFunc
+	var bmu sync.Mutex
+	subscribe := func() error {
+		bc, err := r.backend.WatchEvents(deliver)
+		if err != nil {
+			return err
+		}
+
+		bmu.Lock()
+		defer bmu.Unlock()
+		if ctx.Err() != nil {
+			bc()
+		} else {
+			bcancel = bc
+		}
+		return nil
+	}
+
+	if err := subscribe(); err != nil {
+		var snap []nacs.Instance
+		if r.file.load(&snap) != nil {
+			cancel()
+			return nil, err
+		}
+
+		mu.Lock()
+		r.stale.set(true)
+		evs := nacs.Diff(nil, snap)
+		nacs.Apply(set, evs)
+		initial = false
+		callback(evs, nil)
+		mu.Unlock()
+
+		go retry(ctx, subscribe)
+	}
+
+	return func() {
+		cancel()
+		bmu.Lock()
+		defer bmu.Unlock()
+		if bcancel != nil {
+			bcancel()
+		}
+	}, nil
+}
+
+// Close stops the retries and closes the backend
+func (r *Registry) Close() error {
+	r.cancel()
+	return r.backend.Close()
+}
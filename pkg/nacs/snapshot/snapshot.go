@@ -0,0 +1,92 @@
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RetryInterval is how often the wrappers retry a backend which is down
+var RetryInterval = time.Second * 5
+
+// file persists a value as json, writes are atomic
+type file struct {
+	path string
+}
+
+func newFile(dir, name string) (file, error) {
+	if name == "" {
+		return file{}, errors.New("snapshot: name is empty")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return file{}, errors.Wrapf(err, "snapshot: create dir %s fail", dir)
+	}
+	return file{path: filepath.Join(dir, name)}, nil
+}
+
+func (f file) save(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
+
+func (f file) load(v any) error {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// retry calls f every RetryInterval until it succeeds or ctx is done
+func retry(ctx context.Context, f func() error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(RetryInterval):
+		}
+		if f() == nil {
+			return
+		}
+	}
+}
+
+// stale is a flag set while the data is served from the snapshot
+type stale struct {
+	mu  sync.RWMutex
+	val bool
+}
+
+func (s *stale) set(v bool) {
+	s.mu.Lock()
+	s.val = v
+	s.mu.Unlock()
+}
+
+func (s *stale) get() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.val
+}
@@ -0,0 +1,189 @@
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cocktail828/go-tools/pkg/nacs"
+	"github.com/cocktail828/go-tools/pkg/nacs/memory"
+	"github.com/cocktail828/go-tools/z"
+	"github.com/stretchr/testify/assert"
+)
+
+var errDown = errors.New("backend is down")
+
+func init() {
+	RetryInterval = time.Millisecond * 20
+}
+
+// flakyConfigor fails while it is down
+type flakyConfigor struct {
+	down    atomic.Bool
+	mu      sync.Mutex
+	payload []byte
+	cb      func(nacs.ConfigInfo, error)
+}
+
+func (c *flakyConfigor) Load(ctx context.Context) (nacs.ConfigInfo, error) {
+	if c.down.Load() {
+		return nacs.ConfigInfo{}, errDown
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return nacs.ConfigInfo{DataID: "test", Payload: c.payload}, nil
+}
+
+func (c *flakyConfigor) Monitor(cb func(nacs.ConfigInfo, error)) (context.CancelFunc, error) {
+	if c.down.Load() {
+		return nil, errDown
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cb = cb
+	return func() {}, nil
+}
+
+func (c *flakyConfigor) Close() error { return nil }
+
+func (c *flakyConfigor) push(payload string) {
+	c.mu.Lock()
+	c.payload = []byte(payload)
+	cb := c.cb
+	c.mu.Unlock()
+	if cb != nil {
+		cb(nacs.ConfigInfo{DataID: "test", Payload: []byte(payload)}, nil)
+	}
+}
+
+func TestConfigor(t *testing.T) {
+	dir := t.TempDir()
+	backend := &flakyConfigor{payload: []byte("v1")}
+
+	// nothing to fall back to
+	backend.down.Store(true)
+	c, err := NewConfigor(backend, dir, "config.json")
+	z.Must(err)
+	_, err = c.Load(context.Background())
+	assert.ErrorIs(t, err, errDown)
+
+	backend.down.Store(false)
+	info, err := c.Load(context.Background())
+	z.Must(err)
+	assert.Equal(t, "v1", string(info.Payload))
+	assert.False(t, c.Stale())
+
+	// a restart while the backend is down boots from the snapshot
+	backend.down.Store(true)
+	backend.payload = []byte("v2")
+	c, err = NewConfigor(backend, dir, "config.json")
+	z.Must(err)
+	defer c.Close()
+	info, err = c.Load(context.Background())
+	z.Must(err)
+	assert.Equal(t, nacs.ConfigInfo{DataID: "test", Payload: []byte("v1")}, info)
+	assert.True(t, c.Stale())
+
+	ch := make(chan string, 16)
+	cancel, err := c.Monitor(func(info nacs.ConfigInfo, err error) {
+		z.Must(err)
+		ch <- string(info.Payload)
+	})
+	z.Must(err)
+	defer cancel()
+
+	// the fresh config is delivered once the backend recovers
+	backend.down.Store(false)
+	assert.Equal(t, "v2", <-ch)
+	assert.Eventually(t, func() bool { return !c.Stale() }, time.Second, time.Millisecond*10)
+
+	assert.Eventually(t, func() bool {
+		backend.mu.Lock()
+		defer backend.mu.Unlock()
+		return backend.cb != nil
+	}, time.Second, time.Millisecond*10)
+	backend.push("v3")
+	assert.Equal(t, "v3", <-ch)
+
+	var snap nacs.ConfigInfo
+	z.Must(c.file.load(&snap))
+	assert.Equal(t, "v3", string(snap.Payload))
+}
+
+// flakyRegistry fails while it is down
+type flakyRegistry struct {
+	*memory.MemoryClient
+	down atomic.Bool
+}
+
+func (r *flakyRegistry) Discover(ctx context.Context) ([]nacs.Instance, error) {
+	if r.down.Load() {
+		return nil, errDown
+	}
+	return r.MemoryClient.Discover(ctx)
+}
+
+func (r *flakyRegistry) WatchEvents(callback func([]nacs.Event, error)) (context.CancelFunc, error) {
+	if r.down.Load() {
+		return nil, errDown
+	}
+	return r.MemoryClient.WatchEvents(callback)
+}
+
+func TestRegistry(t *testing.T) {
+	dir := t.TempDir()
+	mc, err := memory.NewStore().Spawn("myns", "svc", "v1")
+	z.Must(err)
+	backend := &flakyRegistry{MemoryClient: mc}
+	a := nacs.Instance{Service: "svc", Host: "10.0.0.1", Port: 80}
+	b := nacs.Instance{Service: "svc", Host: "10.0.0.2", Port: 80}
+	_, err = backend.Register(context.Background(), a)
+	z.Must(err)
+
+	r, err := NewRegistry(backend, dir, "instances.json")
+	z.Must(err)
+	insts, err := r.Discover(context.Background())
+	z.Must(err)
+	assert.Equal(t, []nacs.Instance{a}, insts)
+	assert.False(t, r.Stale())
+
+	// the snapshot is served while the backend is down
+	backend.down.Store(true)
+	r, err = NewRegistry(backend, dir, "instances.json")
+	z.Must(err)
+	defer r.Close()
+	insts, err = r.Discover(context.Background())
+	z.Must(err)
+	assert.Equal(t, []nacs.Instance{a}, insts)
+	assert.True(t, r.Stale())
+
+	ch := make(chan []nacs.Event, 16)
+	cancel, err := r.WatchEvents(func(evs []nacs.Event, err error) {
+		z.Must(err)
+		ch <- evs
+	})
+	z.Must(err)
+	defer cancel()
+	assert.Equal(t, []nacs.Event{{Type: nacs.EventAdded, Instance: a}}, <-ch)
+
+	// the difference is delivered once the backend recovers
+	_, err = backend.Register(context.Background(), b)
+	z.Must(err)
+	backend.down.Store(false)
+	evs := <-ch
+	assert.Len(t, evs, 1)
+	assert.Equal(t, nacs.EventAdded, evs[0].Type)
+	assert.Equal(t, b, evs[0].Instance)
+	assert.False(t, r.Stale())
+
+	// changes keep the snapshot up to date
+	z.Must(backend.DeRegister(context.Background(), a))
+	evs = <-ch
+	assert.Equal(t, nacs.EventRemoved, evs[0].Type)
+	var snap []nacs.Instance
+	z.Must(r.file.load(&snap))
+	assert.Equal(t, []nacs.Instance{b}, snap)
+}
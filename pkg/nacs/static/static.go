@@ -2,10 +2,16 @@ package static
 
 import (
 	"context"
+	"encoding/base64"
+	"net/url"
 
 	"github.com/cocktail828/go-tools/pkg/nacs"
 )
 
+func init() {
+	nacs.RegisterConfigor("static", NewStaticConfigorFromURL)
+}
+
 type staticConfigor struct {
 	payload []byte
 }
@@ -16,6 +22,20 @@ func NewStaticConfigor(payload []byte) nacs.Configor {
 	}
 }
 
+// static://?payload=$payload
+// static://?payload=$payload&encoding=base64
+func NewStaticConfigorFromURL(u *url.URL) (nacs.Configor, error) {
+	query := u.Query()
+	payload := []byte(query.Get("payload"))
+	if query.Get("encoding") == "base64" {
+		var err error
+		if payload, err = base64.StdEncoding.DecodeString(query.Get("payload")); err != nil {
+			return nil, err
+		}
+	}
+	return NewStaticConfigor(payload), nil
+}
+
 func (s *staticConfigor) Load(ctx context.Context) (nacs.ConfigInfo, error) {
 	return nacs.ConfigInfo{
 		DataID:  "static",
@@ -0,0 +1,310 @@
+package httpx
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/cocktail828/go-tools/exp/hystrix"
+	"github.com/cocktail828/go-tools/pkg/retry"
+	"github.com/cocktail828/go-tools/xlog"
+	"github.com/cocktail828/go-tools/z/chain"
+	"github.com/pkg/errors"
+)
+
+// Handler sends the request, it is the rest of the chain seen by a middleware
+type Handler func(req *http.Request) (*http.Response, error)
+
+// Middleware intercepts the round trip of a request like the interceptors of z/chain,
+// it calls next to go on, and it must not modify the request in place but clone it.
+type Middleware func(req *http.Request, next Handler) (*http.Response, error)
+
+func (m Middleware) interceptor() chain.UnaryInterceptor[*http.Request] {
+	return func(ctx context.Context, req *http.Request, handler chain.UnaryHandler[*http.Request]) (any, error) {
+		return m(req, func(req *http.Request) (*http.Response, error) {
+			resp, err := handler(req.Context(), req)
+			r, _ := resp.(*http.Response)
+			return r, err
+		})
+	}
+}
+
+type chainTransport struct {
+	transport   http.RoundTripper
+	interceptor chain.UnaryInterceptor[*http.Request]
+}
+
+// Chain wraps the transport with the middlewares, the first middleware is the outermost one.
+// http.DefaultTransport is used if the transport is nil.
+func Chain(transport http.RoundTripper, mws ...Middleware) http.RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	interceptors := make([]chain.UnaryInterceptor[*http.Request], 0, len(mws))
+	for _, m := range mws {
+		interceptors = append(interceptors, m.interceptor())
+	}
+	return &chainTransport{transport: transport, interceptor: chain.ChainInterceptors(interceptors...)}
+}
+
+func (t *chainTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.interceptor(req.Context(), req, func(ctx context.Context, req *http.Request) (any, error) {
+		return t.transport.RoundTrip(req)
+	})
+	r, _ := resp.(*http.Response)
+	return r, err
+}
+
+// Use sends the request through the middlewares, on top of the transport of the client
+func Use(mws ...Middleware) Option {
+	return func(o *option) { o.middlewares = append(o.middlewares, mws...) }
+}
+
+// drain discards the rest of the body so the connection can be reused
+func drain(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+}
+
+// Idempotent tells whether the request is safe to send more than once,
+// a request with the Idempotency-Key header is idempotent as well.
+func Idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+// RetryStatus is the status codes retried by the Retry middleware
+var RetryStatus = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// StatusError is the error of a response retried or broken on its status
+type StatusError struct {
+	StatusCode int
+}
+
+func (e StatusError) Error() string {
+	return "unexpected status " + http.StatusText(e.StatusCode)
+}
+
+// Retry retries the idempotent requests on the transport errors and the RetryStatus responses by pkg/retry.
+// The Retry-After header of the response overrides the backoff, the response of the last attempt is returned as is.
+// A request with a body is retried only if its GetBody is set, like the ones created by http.NewRequest.
+func Retry(opts ...retry.Option) Middleware {
+	// the options are shared by the requests, appending to them must not write to the same array
+	opts = slices.Clip(opts)
+	return func(req *http.Request, next Handler) (*http.Response, error) {
+		if !Idempotent(req) || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+			return next(req)
+		}
+		replay := req.GetBody != nil && req.Body != nil && req.Body != http.NoBody
+		if replay {
+			// every attempt sends a copy got by GetBody, the original body is closed by the round trip still
+			defer req.Body.Close()
+		}
+
+		var last *http.Response
+		_, err := retry.DoWithData(func() (struct{}, error) {
+			if last != nil {
+				drain(last)
+				last = nil
+			}
+
+			attempt := req
+			if replay {
+				body, err := req.GetBody()
+				if err != nil {
+					return struct{}{}, retry.MarkPermanent(err)
+				}
+				attempt = req.Clone(req.Context())
+				attempt.Body = body
+			}
+
+			resp, err := next(attempt)
+			if err != nil {
+				if req.Context().Err() != nil {
+					return struct{}{}, retry.MarkPermanent(err)
+				}
+				return struct{}{}, err
+			}
+			last = resp
+			if !slices.Contains(RetryStatus, resp.StatusCode) {
+				return struct{}{}, nil
+			}
+
+			var serr error = StatusError{resp.StatusCode}
+			if d, ok := retry.ParseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				serr = retry.WithRetryAfter(serr, d)
+			}
+			return struct{}{}, serr
+		}, append(opts, retry.Context(req.Context()))...)
+
+		if last != nil {
+			return last, nil
+		}
+		return nil, err
+	}
+}
+
+// cancelBody cancels the context of the request once the body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// Breaker runs the requests on the hystrix circuit of the host, named by the host of the url.
+// The circuits are configured by hystrix.ConfigureCommand with the host, the 5xx responses count as failures.
+// A request taking longer than the timeout of the circuit is aborted.
+func Breaker() Middleware {
+	return func(req *http.Request, next Handler) (*http.Response, error) {
+		ctx, cancel := context.WithCancel(req.Context())
+		var started atomic.Bool
+		done := make(chan *http.Response, 1)
+
+		err := hystrix.DoC(ctx, req.URL.Host, func(ctx context.Context) error {
+			started.Store(true)
+			resp, err := next(req.WithContext(ctx))
+			done <- resp
+			if err != nil {
+				return err
+			}
+			if resp.StatusCode >= http.StatusInternalServerError {
+				return StatusError{resp.StatusCode}
+			}
+			return nil
+		})
+
+		var serr StatusError
+		select {
+		case resp := <-done:
+			if resp != nil && (err == nil || errors.As(err, &serr)) {
+				resp.Body = cancelBody{resp.Body, cancel}
+				return resp, nil
+			}
+			if resp != nil {
+				drain(resp)
+			}
+		default:
+			// the circuit gave up on the request still in flight
+			if started.Load() {
+				go func() {
+					if resp := <-done; resp != nil {
+						drain(resp)
+					}
+				}()
+			}
+		}
+		cancel()
+		return nil, err
+	}
+}
+
+// Logging logs the method, the url, the status and the latency of every request.
+// It is put after RequestID in the chain to log the request ID.
+func Logging(logger xlog.Printer) Middleware {
+	return func(req *http.Request, next Handler) (*http.Response, error) {
+		start := time.Now()
+		resp, err := next(req)
+		latency := time.Since(start)
+
+		id := req.Header.Get(RequestIDHeader)
+		if err != nil {
+			logger.Printf("httpx: %s %s request_id=%q latency=%v err: %v", req.Method, req.URL.Redacted(), id, latency, err)
+		} else {
+			logger.Printf("httpx: %s %s request_id=%q latency=%v status=%d", req.Method, req.URL.Redacted(), id, latency, resp.StatusCode)
+		}
+		return resp, err
+	}
+}
+
+// BearerAuth sets the bearer token of the Authorization header, unless it is set already
+func BearerAuth(token string) Middleware {
+	return BearerAuthFunc(func(*http.Request) (string, error) { return token, nil })
+}
+
+// BearerAuthFunc sets the bearer token got by the function on every request, so the token can be refreshed
+func BearerAuthFunc(token func(*http.Request) (string, error)) Middleware {
+	return func(req *http.Request, next Handler) (*http.Response, error) {
+		if req.Header.Get("Authorization") != "" {
+			return next(req)
+		}
+		tok, err := token(req)
+		if err != nil {
+			return nil, errors.Wrap(err, "get bearer token")
+		}
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", "Bearer "+tok)
+		return next(req)
+	}
+}
+
+// BasicAuth sets the basic credential of the Authorization header, unless it is set already
+func BasicAuth(username, password string) Middleware {
+	return func(req *http.Request, next Handler) (*http.Response, error) {
+		if req.Header.Get("Authorization") != "" {
+			return next(req)
+		}
+		req = req.Clone(req.Context())
+		req.SetBasicAuth(username, password)
+		return next(req)
+	}
+}
+
+// RequestIDHeader is the header carrying the request ID
+const RequestIDHeader = "X-Request-Id"
+
+type requestIDKey struct{}
+
+// WithRequestID carries the request ID in the context, so it is propagated to the outgoing requests
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFrom returns the request ID carried by the context
+func RequestIDFrom(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok && id != ""
+}
+
+// NewRequestID generates a random request ID
+func NewRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// RequestID sets the RequestIDHeader of the requests unless it is set already.
+// The ID carried by the context of the request is used, otherwise one is generated by gen, NewRequestID if nil.
+func RequestID(gen func() string) Middleware {
+	if gen == nil {
+		gen = NewRequestID
+	}
+	return func(req *http.Request, next Handler) (*http.Response, error) {
+		if req.Header.Get(RequestIDHeader) != "" {
+			return next(req)
+		}
+		id, ok := RequestIDFrom(req.Context())
+		if !ok {
+			id = gen()
+		}
+		req = req.Clone(req.Context())
+		req.Header.Set(RequestIDHeader, id)
+		return next(req)
+	}
+}
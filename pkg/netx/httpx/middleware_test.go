@@ -0,0 +1,243 @@
+package httpx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cocktail828/go-tools/exp/hystrix"
+	"github.com/cocktail828/go-tools/pkg/retry"
+	"github.com/cocktail828/go-tools/z"
+	"github.com/stretchr/testify/assert"
+)
+
+// printer collects the logs
+type printer struct {
+	mu   sync.Mutex
+	logs []string
+}
+
+func (p *printer) Printf(format string, v ...any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.logs = append(p.logs, fmt.Sprintf(format, v...))
+}
+
+func TestChain(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Trace")))
+	}))
+	defer srv.Close()
+
+	trace := func(name string) Middleware {
+		return func(req *http.Request, next Handler) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			req.Header.Set("X-Trace", req.Header.Get("X-Trace")+name)
+			return next(req)
+		}
+	}
+	client := &http.Client{Transport: Chain(nil, trace("1"), trace("2"), trace("3"))}
+	resp, err := client.Get(srv.URL)
+	z.Must(err)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "123", string(body))
+
+	// the middlewares through the options of Do
+	r, err := Get(context.Background(), srv.URL, Use(trace("a"), trace("b")))
+	z.Must(err)
+	payload, err := r.Payload()
+	z.Must(err)
+	body, _ = io.ReadAll(payload)
+	assert.Equal(t, "ab", string(body))
+}
+
+func TestRetryMiddleware(t *testing.T) {
+	var calls atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != "" && string(body) != "payload" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if calls.Add(1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: Chain(nil, Retry(retry.Attempts(3), retry.Delay(retry.FixedDelay(time.Second))))}
+
+	// the body is replayed, the Retry-After overrides the backoff
+	start := time.Now()
+	req, _ := http.NewRequest(http.MethodPut, srv.URL, strings.NewReader("payload"))
+	resp, err := client.Do(req)
+	z.Must(err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.EqualValues(t, 3, calls.Load())
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+
+	// a POST is not idempotent
+	calls.Store(0)
+	resp, err = client.Post(srv.URL, "text/plain", strings.NewReader("payload"))
+	z.Must(err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.EqualValues(t, 1, calls.Load())
+
+	// unless it has an idempotency key
+	calls.Store(0)
+	req, _ = http.NewRequest(http.MethodPost, srv.URL, bytes.NewReader([]byte("payload")))
+	req.Header.Set("Idempotency-Key", "k")
+	resp, err = client.Do(req)
+	z.Must(err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// the response of the last attempt is returned
+	calls.Store(-10)
+	resp, err = client.Get(srv.URL)
+	z.Must(err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.EqualValues(t, -7, calls.Load())
+
+	// the transport errors are retried
+	var dials atomic.Int64
+	client = &http.Client{Transport: Chain(&http.Transport{
+		Proxy: func(*http.Request) (*url.URL, error) { dials.Add(1); return nil, io.ErrUnexpectedEOF },
+	}, Retry(retry.Attempts(2), retry.Delay(retry.FixedDelay(time.Millisecond))))}
+	_, err = client.Get(srv.URL)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.EqualValues(t, 2, dials.Load())
+
+	// the original body is closed though the attempts send the copies
+	calls.Store(0)
+	client = &http.Client{Transport: Chain(nil, Retry(retry.Attempts(3), retry.Delay(retry.FixedDelay(time.Millisecond))))}
+	body := &closeBody{Reader: strings.NewReader("payload")}
+	req, _ = http.NewRequest(http.MethodPut, srv.URL, body)
+	req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader("payload")), nil }
+	resp, err = client.Do(req)
+	z.Must(err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, body.closed.Load())
+
+	// the options with spare capacity are shared by the concurrent requests safely
+	opts := make([]retry.Option, 1, 4)
+	opts[0] = retry.Attempts(1)
+	client = &http.Client{Transport: Chain(nil, Retry(opts...))}
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+			if resp, err := client.Do(req); assert.NoError(t, err) {
+				resp.Body.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Nil(t, opts[:2][1])
+}
+
+type closeBody struct {
+	io.Reader
+	closed atomic.Bool
+}
+
+func (b *closeBody) Close() error {
+	b.closed.Store(true)
+	return nil
+}
+
+func TestBreakerMiddleware(t *testing.T) {
+	defer hystrix.Flush()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+			}
+		case "/fail":
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	cfg := hystrix.NewConfig()
+	cfg.Timeout.Update(50 * time.Millisecond)
+	hystrix.ConfigureCommand(host, cfg)
+	client := &http.Client{Transport: Chain(nil, Breaker())}
+
+	resp, err := client.Get(srv.URL)
+	z.Must(err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "ok", string(body), "the body outlives the circuit")
+
+	// the failed response is returned as is
+	resp, err = client.Get(srv.URL + "/fail")
+	z.Must(err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+	start := time.Now()
+	_, err = client.Get(srv.URL + "/slow")
+	assert.ErrorIs(t, err, hystrix.ErrTimeout)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+
+	hystrix.GetCircuit(host).Trigger(true)
+	_, err = client.Get(srv.URL)
+	assert.ErrorIs(t, err, hystrix.ErrCircuitOpen)
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization") + "|" + r.Header.Get(RequestIDHeader)))
+	}))
+	defer srv.Close()
+
+	get := func(ctx context.Context, mws ...Middleware) string {
+		r, err := Get(ctx, srv.URL, Use(mws...))
+		z.Must(err)
+		payload, err := r.Payload()
+		z.Must(err)
+		body, _ := io.ReadAll(payload)
+		return string(body)
+	}
+
+	assert.Equal(t, "Bearer token|", get(context.Background(), BearerAuth("token")))
+	assert.Equal(t, "Basic dXNlcjpwYXNz|", get(context.Background(), BasicAuth("user", "pass")))
+	assert.Equal(t, "Bearer first|", get(context.Background(), BearerAuth("first"), BearerAuth("second")))
+	_, err := Get(context.Background(), srv.URL, Use(BearerAuthFunc(func(*http.Request) (string, error) { return "", io.EOF })))
+	assert.ErrorIs(t, err, io.EOF)
+
+	// the request ID is propagated by the context or generated
+	logger := &printer{}
+	assert.Equal(t, "|req-1", get(WithRequestID(context.Background(), "req-1"), RequestID(nil), Logging(logger)))
+	assert.Equal(t, "|gen", get(context.Background(), RequestID(func() string { return "gen" })))
+	assert.Len(t, NewRequestID(), 32)
+	assert.Len(t, logger.logs, 1)
+	assert.Contains(t, logger.logs[0], `request_id="req-1"`)
+	assert.Contains(t, logger.logs[0], "status=200")
+}
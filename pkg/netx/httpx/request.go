@@ -8,10 +8,11 @@ import (
 )
 
 type option struct {
-	body     []byte
-	headers  map[string]string
-	callback func(*http.Request)
-	client   *http.Client
+	body        []byte
+	headers     map[string]string
+	callback    func(*http.Request)
+	client      *http.Client
+	middlewares []Middleware
 }
 
 type Option func(*option)
@@ -61,6 +62,11 @@ func Do(ctx context.Context, method string, url string, opts ...Option) (*Respon
 	if o.client != nil {
 		cli = o.client
 	}
+	if len(o.middlewares) > 0 {
+		c := *cli
+		c.Transport = Chain(cli.Transport, o.middlewares...)
+		cli = &c
+	}
 
 	resp, err := cli.Do(req)
 	if err != nil {
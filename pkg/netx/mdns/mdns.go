@@ -21,10 +21,12 @@ type Instance struct {
 	Info     []string       // optional, service info, e.g. "My awesome service"
 }
 
-func Announce(ctx context.Context, inst Instance) error {
+// Serve announces the instance in background.
+// The announcement stops once the returned shutdown function is called.
+func Serve(inst Instance) (shutdown func() error, err error) {
 	svc, err := mdns.NewMDNSService(inst.Name, inst.Service, inst.Domain, inst.HostName, inst.Port, inst.IPs, inst.Info)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	srv, err := mdns.NewServer(&mdns.Config{
@@ -32,10 +34,19 @@ func Announce(ctx context.Context, inst Instance) error {
 		Iface:  inst.Iface,
 		Logger: log.New(io.Discard, "mdns.query: ", log.LstdFlags),
 	})
+	if err != nil {
+		return nil, err
+	}
+	return srv.Shutdown, nil
+}
+
+// Announce announces the instance until ctx is canceled.
+func Announce(ctx context.Context, inst Instance) error {
+	shutdown, err := Serve(inst)
 	if err != nil {
 		return err
 	}
-	defer srv.Shutdown()
+	defer shutdown()
 
 	// Wait for context cancellation
 	<-ctx.Done()
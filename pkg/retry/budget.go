@@ -0,0 +1,71 @@
+package retry
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrBudgetExhausted is appended to the errors once the retry budget forbids a retry
+var ErrBudgetExhausted = errors.New("retry budget exhausted")
+
+// Budget is a token bucket of retries shared by the callers, it bounds the retries to a ratio of the requests.
+// Every request deposits ratio tokens, every retry withdraws one token.
+// The bucket is refilled by minPerSecond tokens per second as well, so rare callers can still retry.
+type Budget struct {
+	ratio        float64
+	minPerSecond float64
+	capacity     float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewBudget creates a budget allowing ratio retries per request plus minPerSecond retries per second,
+// at most capacity retries are saved up. The bucket starts full.
+func NewBudget(ratio, minPerSecond, capacity float64) *Budget {
+	capacity = max(capacity, 1)
+	return &Budget{
+		ratio:        max(ratio, 0),
+		minPerSecond: max(minPerSecond, 0),
+		capacity:     capacity,
+		tokens:       capacity,
+		last:         time.Now(),
+	}
+}
+
+// refillLocked adds the tokens of the elapsed time
+func (b *Budget) refillLocked() {
+	now := time.Now()
+	b.tokens = min(b.capacity, b.tokens+b.minPerSecond*now.Sub(b.last).Seconds())
+	b.last = now
+}
+
+// Deposit records a request
+func (b *Budget) Deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refillLocked()
+	b.tokens = min(b.capacity, b.tokens+b.ratio)
+}
+
+// Withdraw takes a token for a retry, it returns false if the budget is exhausted
+func (b *Budget) Withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refillLocked()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Tokens returns the retries left in the budget
+func (b *Budget) Tokens() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refillLocked()
+	return b.tokens
+}
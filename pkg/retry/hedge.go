@@ -0,0 +1,146 @@
+package retry
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Latencies keeps the recent latencies of the calls, so the hedged attempts can be delayed by a percentile
+type Latencies struct {
+	mu     sync.Mutex
+	buffer []time.Duration
+	pos    int
+}
+
+// NewLatencies keeps the latest size latencies
+func NewLatencies(size int) *Latencies {
+	return &Latencies{buffer: make([]time.Duration, 0, max(size, 1))}
+}
+
+// Observe records a latency
+func (l *Latencies) Observe(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.buffer) < cap(l.buffer) {
+		l.buffer = append(l.buffer, d)
+		return
+	}
+	l.buffer[l.pos] = d
+	l.pos = (l.pos + 1) % len(l.buffer)
+}
+
+// Percentile returns the latency at the percentile (0~100), ok is false if no latency is observed
+func (l *Latencies) Percentile(p float64) (d time.Duration, ok bool) {
+	l.mu.Lock()
+	sorted := slices.Clone(l.buffer)
+	l.mu.Unlock()
+	if len(sorted) == 0 {
+		return 0, false
+	}
+
+	slices.Sort(sorted)
+	idx := int(p / 100 * float64(len(sorted)-1))
+	return sorted[min(max(idx, 0), len(sorted)-1)], true
+}
+
+// PercentileDelay delays the hedged attempts by the latency at the percentile,
+// fallback is used until a latency is observed.
+func PercentileDelay(l *Latencies, p float64, fallback time.Duration) DelayFunc {
+	return func(_ uint) time.Duration {
+		if d, ok := l.Percentile(p); ok {
+			return d
+		}
+		return fallback
+	}
+}
+
+type hedgeResult[T any] struct {
+	val     T
+	err     error
+	latency time.Duration
+}
+
+// Hedge runs f, and fires another speculative attempt once no attempt returns within the delay,
+// a failed attempt fires the next one after the delay as well. The first success is returned and the other attempts are canceled.
+// Attempts bounds the attempts in total, default 2. Delay gives the delay before the nth hedged attempt,
+// see PercentileDelay. RetryIf, OnRetry and RetryBudget apply to the hedged attempts as well,
+// OnRetry gets the error of the last failed attempt, nil if the attempts in flight have not failed.
+// Once RetryIf rejects an error, no more attempts are fired and the error is returned after the attempts in flight.
+func Hedge[T any](ctx context.Context, f func(context.Context) (T, error), opts ...Option) (T, error) {
+	cfg := newConfig(append([]Option{Attempts(2)}, opts...)...)
+	if cfg.budget != nil {
+		cfg.budget.Deposit()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan hedgeResult[T])
+	var fired, running uint
+	fire := func() {
+		fired++
+		running++
+		go func() {
+			start := time.Now()
+			val, err := f(ctx)
+			select {
+			case results <- hedgeResult[T]{val, err, time.Since(start)}:
+			case <-ctx.Done():
+			}
+		}()
+	}
+	// more tells whether one more attempt may be fired after the error
+	more := func(err error) bool {
+		if cfg.attempts > 0 && fired >= cfg.attempts {
+			return false
+		}
+		return err == nil || cfg.retryIf == nil || cfg.retryIf(fired, err)
+	}
+
+	fire()
+	timer := time.NewTimer(cfg.delay(fired))
+	defer timer.Stop()
+
+	var zero T
+	var failed error // the failure waiting for the next attempt
+	var stopped bool // an error is not retried, no more attempts are fired
+	errs := Error{}
+	for {
+		select {
+		case r := <-results:
+			running--
+			if r.err == nil {
+				if cfg.latencies != nil {
+					cfg.latencies.Observe(r.latency)
+				}
+				return r.val, nil
+			}
+			errs = append(errs, r.err)
+			if !stopped && more(r.err) {
+				// back off before the next attempt, a failing f must not spin
+				failed = r.err
+				timer.Reset(cfg.delay(fired))
+				continue
+			}
+			stopped = true
+			if running == 0 {
+				return zero, errs
+			}
+
+		case <-timer.C:
+			if !stopped && more(failed) && (cfg.budget == nil || cfg.budget.Withdraw()) {
+				cfg.onRetry(fired, failed)
+				failed = nil
+				fire()
+				timer.Reset(cfg.delay(fired))
+			} else if running == 0 {
+				return zero, errs
+			}
+
+		case <-ctx.Done():
+			return zero, append(errs, ctx.Err())
+		}
+	}
+}
@@ -2,14 +2,19 @@ package retry
 
 import (
 	"context"
+	"time"
 )
 
 type retryConfig struct {
-	attempts uint
-	delay    DelayFunc
-	onRetry  func(attempt uint, err error)
-	retryIf  func(attempt uint, err error) bool
-	context  context.Context
+	attempts  uint
+	delay     DelayFunc
+	onRetry   func(attempt uint, err error)
+	retryIf   func(attempt uint, err error) bool
+	context   context.Context
+	budget    *Budget
+	latencies *Latencies
+	policy    *Policy
+	timeout   time.Duration // per attempt, DoCtx only
 }
 
 // Option represents an option for retry.
@@ -50,3 +55,31 @@ func Context(ctx context.Context) Option {
 		c.context = ctx
 	}
 }
+
+// RetryBudget shares the budget of retries among the calls, a call stops retrying once the budget is exhausted
+func RetryBudget(b *Budget) Option {
+	return func(c *retryConfig) {
+		c.budget = b
+	}
+}
+
+// ObserveLatency records the latency of the successful attempts, see PercentileDelay
+func ObserveLatency(l *Latencies) Option {
+	return func(c *retryConfig) {
+		c.latencies = l
+	}
+}
+
+// RetryPolicy classifies the errors, the permanent ones are not retried and the others are delayed by their class
+func RetryPolicy(p Policy) Option {
+	return func(c *retryConfig) {
+		c.policy = &p
+	}
+}
+
+// AttemptTimeout bounds every attempt of DoCtx, 0 means no bound
+func AttemptTimeout(d time.Duration) Option {
+	return func(c *retryConfig) {
+		c.timeout = d
+	}
+}
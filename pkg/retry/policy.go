@@ -0,0 +1,136 @@
+package retry
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Class is the class of an error in the retry policy
+type Class int
+
+const (
+	Retryable Class = iota // retried with the delay of the policy
+	Permanent              // not retried
+	Throttled              // retried with the throttled delay of the policy
+)
+
+func (c Class) String() string {
+	switch c {
+	case Retryable:
+		return "retryable"
+	case Permanent:
+		return "permanent"
+	case Throttled:
+		return "throttled"
+	default:
+		return "unknown"
+	}
+}
+
+// Policy classifies the errors and delays the retries by class
+type Policy struct {
+	// Classify tells the class of the error, by default the errors marked by MarkPermanent are permanent,
+	// the errors carrying a delay requested by the server are throttled, the others are retryable.
+	Classify func(err error) Class
+	// Retryable delays the retries of the retryable errors, nil takes the Delay option
+	Retryable DelayFunc
+	// Throttled delays the retries of the throttled errors, nil takes the Delay option
+	Throttled DelayFunc
+}
+
+func (p *Policy) classify(err error) Class {
+	if p.Classify != nil {
+		return p.Classify(err)
+	}
+	if IsPermanent(err) {
+		return Permanent
+	}
+	if _, ok := RetryAfterOf(err); ok {
+		return Throttled
+	}
+	return Retryable
+}
+
+// delay returns the delay before the next attempt, ok is false if the error should not be retried
+func (p *Policy) delay(attempt uint, err error, fallback DelayFunc) (time.Duration, bool) {
+	var delay DelayFunc
+	switch p.classify(err) {
+	case Permanent:
+		return 0, false
+	case Throttled:
+		delay = p.Throttled
+	default:
+		delay = p.Retryable
+	}
+	if delay == nil {
+		delay = fallback
+	}
+	return delay(attempt), true
+}
+
+type permanentError struct{ error }
+
+func (e permanentError) Unwrap() error { return e.error }
+
+// MarkPermanent marks the error as permanent, it stops the retries whatever the policy is
+func MarkPermanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+// IsPermanent tells whether the error is marked as permanent
+func IsPermanent(err error) bool {
+	var pe permanentError
+	return errors.As(err, &pe)
+}
+
+// RetryAfterer is implemented by the errors carrying a delay requested by the server,
+// the delay overrides the computed backoff.
+type RetryAfterer interface {
+	RetryAfter() time.Duration
+}
+
+type retryAfterError struct {
+	error
+	after time.Duration
+}
+
+func (e retryAfterError) Unwrap() error             { return e.error }
+func (e retryAfterError) RetryAfter() time.Duration { return e.after }
+
+// WithRetryAfter attaches the delay requested by the server to the error
+func WithRetryAfter(err error, after time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return retryAfterError{err, after}
+}
+
+// RetryAfterOf returns the delay requested by the server carried by the error
+func RetryAfterOf(err error) (time.Duration, bool) {
+	var ra RetryAfterer
+	if errors.As(err, &ra) {
+		return max(ra.RetryAfter(), 0), true
+	}
+	return 0, false
+}
+
+// ParseRetryAfter parses the HTTP Retry-After header, in delay-seconds or in HTTP-date
+func ParseRetryAfter(header string) (time.Duration, bool) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0, false
+	}
+	if secs, err := strconv.ParseInt(header, 10, 64); err == nil {
+		return max(time.Duration(secs)*time.Second, 0), true
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
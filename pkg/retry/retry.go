@@ -14,6 +14,25 @@ func Do(f func() error, opts ...Option) error {
 }
 
 func DoWithData[T any](f func() (T, error), opts ...Option) (T, error) {
+	return retry(f, newConfig(opts...))
+}
+
+// DoCtx retries f with the context, the Context option is overridden by ctx.
+// Every attempt gets a context bounded by AttemptTimeout, a timeout attempt is retried as long as ctx is not done.
+func DoCtx[T any](ctx context.Context, f func(context.Context) (T, error), opts ...Option) (T, error) {
+	cfg := newConfig(opts...)
+	cfg.context = ctx
+	return retry(func() (T, error) {
+		actx, cancel := ctx, context.CancelFunc(func() {})
+		if cfg.timeout > 0 {
+			actx, cancel = context.WithTimeout(ctx, cfg.timeout)
+		}
+		defer cancel()
+		return f(actx)
+	}, cfg)
+}
+
+func newConfig(opts ...Option) *retryConfig {
 	cfg := &retryConfig{
 		attempts: 3,
 		delay:    FixedDelay(time.Millisecond * 100),
@@ -25,8 +44,7 @@ func DoWithData[T any](f func() (T, error), opts ...Option) (T, error) {
 	for _, opt := range opts {
 		opt(cfg)
 	}
-
-	return retry(f, cfg)
+	return cfg
 }
 
 func retry[T any](f func() (T, error), cfg *retryConfig) (t T, oerr error) {
@@ -40,9 +58,17 @@ func retry[T any](f func() (T, error), cfg *retryConfig) (t T, oerr error) {
 		}
 	}()
 
+	if cfg.budget != nil {
+		cfg.budget.Deposit()
+	}
+
 	for {
+		start := time.Now()
 		t, err := f()
 		if err == nil {
+			if cfg.latencies != nil {
+				cfg.latencies.Observe(time.Since(start))
+			}
 			return t, nil
 		}
 		n++
@@ -60,10 +86,33 @@ func retry[T any](f func() (T, error), cfg *retryConfig) (t T, oerr error) {
 			return t, errs
 		}
 
+		// the policy tells the delay by the class of the error, the permanent errors are not retried
+		var delay time.Duration
+		if cfg.policy != nil {
+			d, ok := cfg.policy.delay(n, err, cfg.delay)
+			if !ok {
+				return t, errs
+			}
+			delay = d
+		} else if IsPermanent(err) {
+			return t, errs
+		} else {
+			delay = cfg.delay(n)
+		}
+		// the delay requested by the server overrides the backoff
+		if d, ok := RetryAfterOf(err); ok {
+			delay = d
+		}
+
+		// the retries are bounded by the shared budget
+		if cfg.budget != nil && !cfg.budget.Withdraw() {
+			return t, append(errs, ErrBudgetExhausted)
+		}
+
 		// if context is nil, retry until delay
 		// if context is not nil, retry until context is done or delay
 		select {
-		case <-time.After(cfg.delay(n)):
+		case <-time.After(delay):
 		case <-cfg.context.Done():
 			return t, errs
 		}
@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -385,3 +387,252 @@ func TestContextCancellation(t *testing.T) {
 	assert.Greater(t, count, 0) // 至少尝试了一次
 	assert.Less(t, count, 10)   // 没有完成所有10次尝试
 }
+
+func TestBudget(t *testing.T) {
+	b := NewBudget(0.5, 0, 2)
+	fail := errors.New("fake error")
+
+	// the bucket starts full: 2 retries
+	i := 0
+	err := Do(func() error { i++; return fail }, Attempts(10), Delay(FixedDelay(time.Millisecond)), RetryBudget(b))
+	assert.Equal(t, 3, i)
+	assert.ErrorIs(t, err, ErrBudgetExhausted)
+	assert.InDelta(t, 0, b.Tokens(), 0.01)
+
+	// two requests earn one retry
+	i = 0
+	assert.NoError(t, Do(func() error { return nil }, RetryBudget(b)))
+	Do(func() error { i++; return fail }, Attempts(10), Delay(FixedDelay(time.Millisecond)), RetryBudget(b))
+	assert.Equal(t, 2, i)
+
+	// refilled by time
+	b = NewBudget(0, 100, 1)
+	assert.True(t, b.Withdraw())
+	assert.False(t, b.Withdraw())
+	time.Sleep(20 * time.Millisecond)
+	assert.True(t, b.Withdraw())
+}
+
+func TestHedge(t *testing.T) {
+	t.Run("hedged-attempt-wins", func(t *testing.T) {
+		var calls sync.WaitGroup
+		calls.Add(2)
+		var canceled atomic.Bool
+		var n atomic.Int32
+		v, err := Hedge(context.Background(), func(ctx context.Context) (int, error) {
+			defer calls.Done()
+			if n.Add(1) == 1 {
+				<-ctx.Done() // the slow one is canceled
+				canceled.Store(true)
+				return 0, ctx.Err()
+			}
+			return 2, nil
+		}, Delay(FixedDelay(10*time.Millisecond)))
+		assert.NoError(t, err)
+		assert.Equal(t, 2, v)
+		calls.Wait()
+		assert.True(t, canceled.Load())
+	})
+
+	t.Run("fast-enough", func(t *testing.T) {
+		var n atomic.Int32
+		v, err := Hedge(context.Background(), func(ctx context.Context) (int32, error) {
+			return n.Add(1), nil
+		}, Delay(FixedDelay(time.Second)))
+		assert.NoError(t, err)
+		assert.EqualValues(t, 1, v)
+		assert.EqualValues(t, 1, n.Load())
+	})
+
+	t.Run("failure-backs-off", func(t *testing.T) {
+		fail := errors.New("fake error")
+		var n atomic.Int32
+		start := time.Now()
+		_, err := Hedge(context.Background(), func(ctx context.Context) (int, error) {
+			n.Add(1)
+			return 0, fail
+		}, Attempts(3), Delay(FixedDelay(20*time.Millisecond)))
+		assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+		assert.EqualValues(t, 3, n.Load())
+		assert.Len(t, err.(Error), 3)
+	})
+
+	t.Run("unlimited-failures", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		var n atomic.Int32
+		_, err := Hedge(ctx, func(ctx context.Context) (int, error) {
+			n.Add(1)
+			return 0, errors.New("fake error")
+		}, Attempts(0), Delay(FixedDelay(10*time.Millisecond)))
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.LessOrEqual(t, n.Load(), int32(12), "the failed attempts are paced by the delay")
+	})
+
+	t.Run("not-retried", func(t *testing.T) {
+		slow, fatal := errors.New("slow error"), errors.New("fatal error")
+		var n atomic.Int32
+		_, err := Hedge(context.Background(), func(ctx context.Context) (int, error) {
+			if n.Add(1) == 1 {
+				time.Sleep(50 * time.Millisecond)
+				return 0, slow
+			}
+			return 0, fatal
+		}, Attempts(0), Delay(FixedDelay(10*time.Millisecond)),
+			RetryIf(func(_ uint, err error) bool { return err != fatal }))
+		assert.EqualValues(t, 2, n.Load(), "no attempt is fired once an error is not retried")
+		assert.Equal(t, Error{fatal, slow}, err)
+	})
+
+	t.Run("context", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err := Hedge(ctx, func(ctx context.Context) (int, error) {
+			<-ctx.Done()
+			return 0, ctx.Err()
+		}, Delay(FixedDelay(5*time.Millisecond)))
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("budget", func(t *testing.T) {
+		b := NewBudget(0, 0, 1)
+		b.Withdraw()
+		var n atomic.Int32
+		v, err := Hedge(context.Background(), func(ctx context.Context) (int32, error) {
+			time.Sleep(20 * time.Millisecond)
+			return n.Add(1), nil
+		}, Delay(FixedDelay(time.Millisecond)), RetryBudget(b))
+		assert.NoError(t, err)
+		assert.EqualValues(t, 1, v, "no budget to hedge")
+	})
+}
+
+func TestPercentileDelay(t *testing.T) {
+	l := NewLatencies(100)
+	delay := PercentileDelay(l, 90, time.Second)
+	assert.Equal(t, time.Second, delay(1))
+
+	for i := range 100 {
+		l.Observe(time.Duration(i+1) * time.Millisecond)
+	}
+	assert.Equal(t, 90*time.Millisecond, delay(1))
+
+	// the latencies of the successful calls are observed
+	l = NewLatencies(10)
+	_, err := Hedge(context.Background(), func(ctx context.Context) (int, error) {
+		time.Sleep(5 * time.Millisecond)
+		return 0, nil
+	}, ObserveLatency(l))
+	assert.NoError(t, err)
+	assert.NoError(t, Do(func() error { return nil }, ObserveLatency(l)))
+	d, ok := l.Percentile(100)
+	assert.True(t, ok)
+	assert.GreaterOrEqual(t, d, 5*time.Millisecond)
+}
+
+func TestDoCtx(t *testing.T) {
+	// every attempt is bounded, the timeout attempts are retried
+	i := 0
+	v, err := DoCtx(context.Background(), func(ctx context.Context) (int, error) {
+		i++
+		if i < 3 {
+			<-ctx.Done()
+			return 0, ctx.Err()
+		}
+		_, ok := ctx.Deadline()
+		assert.True(t, ok)
+		return i, nil
+	}, AttemptTimeout(10*time.Millisecond), Delay(FixedDelay(time.Millisecond)))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, v)
+
+	// the context of DoCtx wins over the Context option
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	i = 0
+	_, err = DoCtx(ctx, func(ctx context.Context) (int, error) {
+		i++
+		return 0, ctx.Err()
+	}, Context(context.Background()), Attempts(5))
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, i)
+
+	// the options of the caller are left alone
+	opts := make([]Option, 1, 2)
+	opts[0] = Attempts(1)
+	DoCtx(ctx, func(ctx context.Context) (int, error) { return 0, nil }, opts...)
+	assert.Nil(t, opts[:2][1])
+}
+
+func TestPolicy(t *testing.T) {
+	fail := errors.New("fake error")
+
+	// permanent errors are not retried
+	i := 0
+	err := Do(func() error { i++; return MarkPermanent(fail) }, Attempts(5))
+	assert.Equal(t, 1, i)
+	assert.ErrorIs(t, err, fail)
+	assert.True(t, IsPermanent(err))
+
+	// the delays follow the class
+	var delays []time.Duration
+	start := time.Now()
+	i = 0
+	err = Do(func() error {
+		delays = append(delays, time.Since(start))
+		start = time.Now()
+		i++
+		switch i {
+		case 1:
+			return net.ErrClosed
+		case 2:
+			return fail
+		default:
+			return nil
+		}
+	}, Attempts(5), Delay(FixedDelay(time.Second)), RetryPolicy(Policy{
+		Classify: func(err error) Class {
+			if errors.Is(err, net.ErrClosed) {
+				return Throttled
+			}
+			return Retryable
+		},
+		Retryable: FixedDelay(time.Millisecond),
+		Throttled: FixedDelay(50 * time.Millisecond),
+	}))
+	assert.NoError(t, err)
+	assert.Len(t, delays, 3)
+	assert.GreaterOrEqual(t, delays[1], 50*time.Millisecond)
+	assert.Less(t, delays[2], 40*time.Millisecond)
+
+	// the default classification
+	p := Policy{}
+	assert.Equal(t, Permanent, p.classify(MarkPermanent(fail)))
+	assert.Equal(t, Throttled, p.classify(WithRetryAfter(fail, time.Second)))
+	assert.Equal(t, Retryable, p.classify(fail))
+	assert.Equal(t, "throttled", Throttled.String())
+}
+
+func TestRetryAfter(t *testing.T) {
+	fail := errors.New("fake error")
+	start := time.Now()
+	i := 0
+	err := Do(func() error {
+		i++
+		return WithRetryAfter(fail, 30*time.Millisecond)
+	}, Attempts(2), Delay(FixedDelay(time.Second)))
+	assert.ErrorIs(t, err, fail)
+	assert.Equal(t, 2, i)
+	elapsed := time.Since(start)
+	assert.GreaterOrEqual(t, elapsed, 30*time.Millisecond)
+	assert.Less(t, elapsed, 500*time.Millisecond, "the server delay overrides the backoff")
+
+	d, ok := ParseRetryAfter("120")
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Minute, d)
+	d, ok = ParseRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	assert.True(t, ok)
+	assert.InDelta(t, time.Hour, d, float64(2*time.Second))
+	_, ok = ParseRetryAfter("soon")
+	assert.False(t, ok)
+}
@@ -1,11 +1,13 @@
 package timex
 
 import (
+	"sync/atomic"
 	_ "unsafe"
 )
 
 var (
-	nanotime = func() int64 { return runtimeNano() } // for debug
+	// the clock is swapped atomically, as the goroutines outliving a test may still read it
+	nanotime atomic.Pointer[func() int64] // for debug
 )
 
 // runtimeNano returns the current value of the runtime clock in nanoseconds.
@@ -13,8 +15,13 @@ var (
 //go:linkname runtimeNano runtime.nanotime
 func runtimeNano() int64
 
-func ResetTime() { nanotime = runtimeNano }
+func ResetTime() { nanotime.Store(nil) }
 
-func SetTime(f func() int64) { nanotime = f }
+func SetTime(f func() int64) { nanotime.Store(&f) }
 
-func UnixNano() int64 { return nanotime() }
+func UnixNano() int64 {
+	if f := nanotime.Load(); f != nil {
+		return (*f)()
+	}
+	return runtimeNano()
+}